@@ -0,0 +1,79 @@
+package rpc
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/polariseye/rpc-go/log"
+)
+
+// 接收连接出错时的重试间隔，每次失败翻倍，直到最大值
+const (
+	minAcceptRetryDelay = 5 * time.Millisecond
+	maxAcceptRetryDelay = 1 * time.Second
+)
+
+// AddAcceptErrorHandler 添加接收连接出错时的处理，可用于监控和报警
+// funcObj:处理函数，retryDelay为重试间隔，为0表示监听已关闭，不会重试，监听将结束
+func (this *RpcServer) AddAcceptErrorHandler(funcName string, funcObj func(listener net.Listener, err error, retryDelay time.Duration)) (err error) {
+	if _, exist := this.acceptErrorHandlerData[funcName]; exist {
+		return HandlerExistedError
+	}
+
+	this.acceptErrorHandlerData[funcName] = funcObj
+	return nil
+}
+
+func (this *RpcServer) invokeAcceptErrorHandler(listener net.Listener, err error, retryDelay time.Duration) {
+	for _, item := range this.acceptErrorHandlerData {
+		item(listener, err, retryDelay)
+	}
+}
+
+// isListenerClosedError 是否是监听已关闭的错误，此时无法再接收连接，需要结束监听
+func isListenerClosedError(err error) bool {
+	return errors.Is(err, net.ErrClosed)
+}
+
+// getAcceptRetryDelay 获取下次重试的间隔
+func getAcceptRetryDelay(retryDelay time.Duration) time.Duration {
+	if retryDelay == 0 {
+		return minAcceptRetryDelay
+	}
+
+	retryDelay *= 2
+	if retryDelay > maxAcceptRetryDelay {
+		retryDelay = maxAcceptRetryDelay
+	}
+
+	return retryDelay
+}
+
+// handleAcceptError 处理接收连接的错误，监听已关闭时返回需要结束监听的错误，其他错误(如文件句柄用完)等待后返回nil以便重试
+// 服务端关闭导致的错误返回ServerClosedError
+func (this *RpcServer) handleAcceptError(listener net.Listener, err error, retryDelay *time.Duration) error {
+	if this.isShutdown() {
+		return ServerClosedError
+	}
+
+	if isListenerClosedError(err) {
+		log.Error("Accept Error Addr:%v error:%v", listener.Addr(), err.Error())
+		this.invokeAcceptErrorHandler(listener, err, 0)
+		return err
+	}
+
+	*retryDelay = getAcceptRetryDelay(*retryDelay)
+	log.Warn("Accept Error Addr:%v error:%v retry after:%v", listener.Addr(), err.Error(), *retryDelay)
+	this.invokeAcceptErrorHandler(listener, err, *retryDelay)
+
+	// 等待重试，期间关闭服务端则立即结束
+	timer := time.NewTimer(*retryDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-this.shutdownChan:
+		return ServerClosedError
+	}
+}
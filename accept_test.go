@@ -0,0 +1,77 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// 接收连接的错误，没有实现Temporary，也需要重试
+type acceptError struct{}
+
+func (this acceptError) Error() string { return "accept error" }
+
+// 前几次接收连接返回错误的监听
+type flakyListener struct {
+	*PipeListener
+	errorCount int
+}
+
+func (this *flakyListener) Accept() (net.Conn, error) {
+	if this.errorCount > 0 {
+		this.errorCount--
+		return nil, acceptError{}
+	}
+
+	return this.PipeListener.Accept()
+}
+
+func TestAcceptRetry(t *testing.T) {
+	listenerObj := &flakyListener{PipeListener: NewPipeListener("TestAcceptRetry"), errorCount: 3}
+
+	var retryDelayList []time.Duration
+	serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+	serverObj.RegisterFunc("Sample", "Echo", func(connObj RpcConnectioner, value int) int { return value })
+	serverObj.AddAcceptErrorHandler("Test", func(listener net.Listener, err error, retryDelay time.Duration) {
+		retryDelayList = append(retryDelayList, retryDelay)
+	})
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- serverObj.Start2(listenerObj)
+	}()
+
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	clientObj.SetDialer(listenerObj)
+	if err := clientObj.Start("TestAcceptRetry", false); err != nil {
+		t.Errorf("start error:%v", err)
+		return
+	}
+	defer clientObj.Close()
+
+	var value int
+	if err := clientObj.Call("Sample_Echo", []interface{}{1}, []interface{}{&value}); err != nil || value != 1 {
+		t.Errorf("call error:%v value:%v", err, value)
+	}
+	if len(retryDelayList) != 3 || retryDelayList[0] != minAcceptRetryDelay || retryDelayList[2] != 4*minAcceptRetryDelay {
+		t.Errorf("retry delay not match:%v", retryDelayList)
+	}
+
+	// 关闭服务端后返回ServerClosedError
+	serverObj.Close()
+	if err := <-errChan; errors.Is(err, ServerClosedError) == false {
+		t.Errorf("start should return server closed error:%v", err)
+	}
+
+	// 外部关闭监听时返回监听的错误
+	listenerObj = &flakyListener{PipeListener: NewPipeListener("TestAcceptRetry")}
+	serverObj = NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+	go func() {
+		errChan <- serverObj.Start2(listenerObj)
+	}()
+	listenerObj.Close()
+	if err := <-errChan; errors.Is(err, net.ErrClosed) == false {
+		t.Errorf("start should return listener closed error:%v", err)
+	}
+}
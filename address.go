@@ -0,0 +1,118 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 检查Unix套接字文件是否有进程在监听时的连接超时时间
+const unixSocketDialTimeout = 100 * time.Millisecond
+
+// 地址格式，没有指定格式时使用tcp
+const (
+	// tcp地址，如：tcp://127.0.0.1:8080
+	AddrScheme_Tcp = "tcp"
+
+	// Unix套接字文件路径，如：unix:///var/run/rpc.sock
+	AddrScheme_Unix = "unix"
+
+	// Linux下的抽象Unix套接字名称，不会创建文件，如：unix-abstract://rpc
+	AddrScheme_UnixAbstract = "unix-abstract"
+
+	// 进程内的内存连接名称，用于测试，如：mem://rpc
+	AddrScheme_Mem = "mem"
+)
+
+// parseAddr 解析带格式的地址
+// addr:地址，如：127.0.0.1:8080、tcp://127.0.0.1:8080、unix:///var/run/rpc.sock、unix-abstract://rpc、mem://rpc
+// 返回值:
+// network:网络类型，用于net.Listen和net.Dial
+// address:去掉格式后的地址
+// err:错误信息
+func parseAddr(addr string) (network string, address string, err error) {
+	index := strings.Index(addr, "://")
+	if index < 0 {
+		return AddrScheme_Tcp, addr, nil
+	}
+
+	scheme, address := addr[:index], addr[index+len("://"):]
+	if address == "" {
+		return "", "", fmt.Errorf("%w:%s", AddrInvalidError, addr)
+	}
+
+	switch scheme {
+	case AddrScheme_Tcp:
+		return "tcp", address, nil
+	case AddrScheme_Unix:
+		return "unix", address, nil
+	case AddrScheme_UnixAbstract:
+		// 以@开头的地址为抽象套接字
+		return "unix", "@" + address, nil
+	case AddrScheme_Mem:
+		return AddrScheme_Mem, address, nil
+	default:
+		return "", "", fmt.Errorf("%w:%s", AddrInvalidError, addr)
+	}
+}
+
+// listen 监听带格式的地址
+func listen(addr string) (net.Listener, error) {
+	network, address, err := parseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if network == AddrScheme_Mem {
+		return listenPipe(address)
+	}
+
+	if network != "unix" || strings.HasPrefix(address, "@") {
+		return net.Listen(network, address)
+	}
+
+	return listenUnix(address)
+}
+
+// listenUnix 监听Unix套接字文件，关闭监听时删除文件
+// 上次进程异常退出时遗留的套接字文件会先删除，有进程正在监听时不删除，由监听返回地址已被使用的错误
+func listenUnix(address string) (net.Listener, error) {
+	if err := removeStaleUnixSocket(address); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		return nil, err
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(true)
+
+	return listener, nil
+}
+
+// removeStaleUnixSocket 删除没有进程监听的套接字文件，文件不存在或不是套接字文件时不处理
+func removeStaleUnixSocket(address string) error {
+	fileInfo, err := os.Lstat(address)
+	if err != nil || fileInfo.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+
+	// 连接被拒绝才说明没有进程在监听，其他错误(如没有权限)不能确定，不删除
+	con, err := net.DialTimeout("unix", address, unixSocketDialTimeout)
+	if err == nil {
+		con.Close()
+		return nil
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) == false {
+		return nil
+	}
+
+	if err = os.Remove(address); err != nil && os.IsNotExist(err) == false {
+		return err
+	}
+
+	return nil
+}
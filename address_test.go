@@ -0,0 +1,110 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseAddr(t *testing.T) {
+	dataList := []struct {
+		addr    string
+		network string
+		address string
+	}{
+		{"127.0.0.1:8080", "tcp", "127.0.0.1:8080"},
+		{"tcp://127.0.0.1:8080", "tcp", "127.0.0.1:8080"},
+		{"unix:///var/run/rpc.sock", "unix", "/var/run/rpc.sock"},
+		{"unix://rpc.sock", "unix", "rpc.sock"},
+		{"unix-abstract://rpc", "unix", "@rpc"},
+	}
+	for _, item := range dataList {
+		network, address, err := parseAddr(item.addr)
+		if err != nil || network != item.network || address != item.address {
+			t.Errorf("parse addr:%v error:%v network:%v address:%v", item.addr, err, network, address)
+		}
+	}
+
+	for _, addr := range []string{"udp://127.0.0.1:8080", "unix://"} {
+		if _, _, err := parseAddr(addr); errors.Is(err, AddrInvalidError) == false {
+			t.Errorf("parse addr:%v should be invalid error:%v", addr, err)
+		}
+	}
+}
+
+func TestUnixAddr(t *testing.T) {
+	addrList := []string{
+		"unix://" + filepath.Join(t.TempDir(), "rpc.sock"),
+		fmt.Sprintf("unix-abstract://rpc-go-test-%v", time.Now().UnixNano()),
+	}
+	for _, addr := range addrList {
+		listener, err := listen(addr)
+		if err != nil {
+			t.Logf("listen addr:%v error:%v", addr, err)
+			continue
+		}
+
+		serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+		serverObj.RegisterFunc("Sample", "Echo", func(connObj RpcConnectioner, value int) int { return value })
+		go serverObj.Start2(listener)
+
+		clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+		if err = clientObj.Start(addr, true); err != nil {
+			t.Errorf("start addr:%v error:%v", addr, err)
+		} else {
+			var value int
+			if err = clientObj.Call("Sample_Echo", []interface{}{1}, []interface{}{&value}); err != nil || value != 1 {
+				t.Errorf("call addr:%v error:%v value:%v", addr, err, value)
+			}
+		}
+
+		clientObj.Close()
+		listener.Close()
+	}
+
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	if err := clientObj.Start("udp://127.0.0.1:8080", true); errors.Is(err, AddrInvalidError) == false {
+		t.Errorf("start should be invalid error:%v", err)
+	}
+}
+
+func TestUnixStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rpc.sock")
+
+	// 模拟进程异常退出时遗留的套接字文件
+	staleListener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("listen unix error:%v", err)
+	}
+	staleListener.(*net.UnixListener).SetUnlinkOnClose(false)
+	staleListener.Close()
+	if _, err = os.Stat(path); err != nil {
+		t.Fatalf("stale socket file not exist:%v", err)
+	}
+
+	listener, err := listen("unix://" + path)
+	if err != nil {
+		t.Fatalf("listen with stale socket file error:%v", err)
+	}
+
+	// 有进程在监听时不删除文件
+	if _, err = listen("unix://" + path); err == nil {
+		t.Errorf("listen should fail when address in use")
+	}
+	if con, err := net.Dial("unix", path); err != nil {
+		t.Errorf("socket file should not be removed:%v", err)
+	} else {
+		con.Close()
+	}
+
+	// 关闭监听时删除文件
+	listener.Close()
+	if _, err = os.Stat(path); os.IsNotExist(err) == false {
+		t.Errorf("socket file should be removed after close:%v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/polariseye/rpc-go/log"
+)
+
+const (
+	// 被拒绝的连接最长的处理时间，用于发送拒绝原因
+	refuseTimeout = 1 * time.Second
+
+	// 同时发送拒绝原因的最大连接数，超过时直接关闭连接
+	maxRefusingCount = 64
+
+	// 发送拒绝原因后最多读取并丢弃的数据长度
+	maxRefuseDrainSize = 4096
+)
+
+// 预先编码的拒绝帧，key:拒绝原因
+var refuseFrameData = map[error][]byte{
+	ConnectionLimitError:     newRefuseFrameBytes(ConnectionLimitError),
+	IPConnectionLimitError:   newRefuseFrameBytes(IPConnectionLimitError),
+	ConnectionRateLimitError: newRefuseFrameBytes(ConnectionRateLimitError),
+}
+
+// newRefuseFrameBytes 编码拒绝握手的应答帧
+// 握手帧的协议头固定使用大端且不带校验码，与连接的配置无关，所以可以预先编码
+// 对方收到握手应答时不检查应答的帧Id，所以不需要读取对方的握手帧
+func newRefuseFrameBytes(err error) []byte {
+	bytesData, _ := json.Marshal(&HelloInfo{
+		Error: fmt.Errorf("%w:%v", HandshakeError, err).Error(),
+	})
+
+	frameObj := newResponseFrame(&DataFrame{RequestFrameId: 1}, bytesData, 1)
+	frameObj.SetTransformType(TransformType_Hello)
+
+	return append(frameObj.GetHeader(binary.BigEndian), bytesData...)
+}
+
+// getRefuseFrameBytes 获取拒绝原因对应的拒绝帧
+func getRefuseFrameBytes(err error) []byte {
+	for refuseErr, bytesData := range refuseFrameData {
+		if errors.Is(err, refuseErr) {
+			return bytesData
+		}
+	}
+
+	return newRefuseFrameBytes(err)
+}
+
+// 连接准入配置，0表示不限制
+type AdmissionConfig struct {
+	MaxConnectionCount        int //// 最大连接数(包含握手中的连接)
+	MaxConnectionCountPerIP   int //// 每个IP的最大连接数，只对tcp连接有效
+	MaxNewConnectionPerSecond int //// 每秒最多接收的新连接数，允许短时间内突发到此数量
+}
+
+// 令牌桶限流
+type rateLimiter struct {
+	rate     float64 //// 每秒产生的令牌数，同时也是桶的容量
+	tokens   float64
+	lastTime time.Time
+}
+
+// allow 是否允许通过，允许则消耗一个令牌
+func (this *rateLimiter) allow(now time.Time) bool {
+	if this.lastTime.IsZero() {
+		this.tokens = this.rate
+	} else {
+		this.tokens += now.Sub(this.lastTime).Seconds() * this.rate
+		if this.tokens > this.rate {
+			this.tokens = this.rate
+		}
+	}
+	this.lastTime = now
+
+	if this.tokens < 1 {
+		return false
+	}
+
+	this.tokens--
+	return true
+}
+
+// SetAdmissionConfig 设置连接准入配置，超过限制的连接会在握手时被拒绝，并告知对方原因
+func (this *RpcServer) SetAdmissionConfig(config AdmissionConfig) {
+	this.admissionLockObj.Lock()
+	defer this.admissionLockObj.Unlock()
+
+	this.admissionConfig = config
+	this.newConnectionLimiter = &rateLimiter{rate: float64(config.MaxNewConnectionPerSecond)}
+}
+
+// RefusedConnectionCount 获取被拒绝的连接数量
+func (this *RpcServer) RefusedConnectionCount() int64 {
+	return atomic.LoadInt64(&this.refusedConnectionCount)
+}
+
+// AddRefuseConnectionHandler 添加连接被拒绝时的处理，可以使用errors.Is判断拒绝原因
+func (this *RpcServer) AddRefuseConnectionHandler(funcName string, funcObj func(con net.Conn, err error)) (err error) {
+	if _, exist := this.refuseHandlerData[funcName]; exist {
+		return HandlerExistedError
+	}
+
+	this.refuseHandlerData[funcName] = funcObj
+	return nil
+}
+
+// getRemoteIP 获取对方IP，不是tcp连接则返回空字符串
+func getRemoteIP(con net.Conn) string {
+	if addr, ok := con.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+
+	return ""
+}
+
+// admit 检查是否允许新连接，允许则计入连接数，连接关闭时需要调用release
+func (this *RpcServer) admit(con net.Conn) error {
+	ip := getRemoteIP(con)
+
+	this.admissionLockObj.Lock()
+	defer this.admissionLockObj.Unlock()
+
+	config := this.admissionConfig
+	if config.MaxConnectionCount > 0 && this.admittedCount >= config.MaxConnectionCount {
+		return fmt.Errorf("%w:max connection count:%v", ConnectionLimitError, config.MaxConnectionCount)
+	}
+	if config.MaxConnectionCountPerIP > 0 && ip != "" && this.ipConnectionCountData[ip] >= config.MaxConnectionCountPerIP {
+		return fmt.Errorf("%w:max connection count per ip:%v", IPConnectionLimitError, config.MaxConnectionCountPerIP)
+	}
+	if config.MaxNewConnectionPerSecond > 0 && this.newConnectionLimiter.allow(time.Now()) == false {
+		return fmt.Errorf("%w:max new connection per second:%v", ConnectionRateLimitError, config.MaxNewConnectionPerSecond)
+	}
+
+	this.admittedCount++
+	if ip != "" {
+		this.ipConnectionCountData[ip]++
+	}
+
+	return nil
+}
+
+// release 连接关闭时减少连接数
+func (this *RpcServer) release(con net.Conn) {
+	ip := getRemoteIP(con)
+
+	this.admissionLockObj.Lock()
+	defer this.admissionLockObj.Unlock()
+
+	this.admittedCount--
+	if ip == "" {
+		return
+	}
+
+	if this.ipConnectionCountData[ip] <= 1 {
+		delete(this.ipConnectionCountData, ip)
+	} else {
+		this.ipConnectionCountData[ip]--
+	}
+}
+
+// refuseConnection 拒绝连接，发送拒绝握手的应答告知对方原因后关闭连接
+// 正在发送拒绝原因的连接数超过maxRefusingCount时直接关闭连接
+func (this *RpcServer) refuseConnection(con net.Conn, err error) {
+	log.Warn("refuse connection ip:%v error:%v", con.RemoteAddr(), err.Error())
+	atomic.AddInt64(&this.refusedConnectionCount, 1)
+	for _, item := range this.refuseHandlerData {
+		item(con, err)
+	}
+
+	if atomic.AddInt32(&this.refusingCount, 1) > maxRefusingCount {
+		atomic.AddInt32(&this.refusingCount, -1)
+		con.Close()
+		return
+	}
+
+	go this.sendRefuse(con, getRefuseFrameBytes(err))
+}
+
+// sendRefuse 发送拒绝帧后关闭连接
+func (this *RpcServer) sendRefuse(con net.Conn, frameBytes []byte) {
+	defer atomic.AddInt32(&this.refusingCount, -1)
+	defer con.Close()
+
+	// 对方没有及时接收时直接关闭，TLS连接的握手也包含在内
+	con.SetDeadline(time.Now().Add(refuseTimeout))
+	if _, err := con.Write(frameBytes); err != nil {
+		return
+	}
+
+	// 关闭时还有未读取的数据会发送RST，对方可能因此丢弃拒绝帧，所以先关闭写入，再读取对方的数据直到对方关闭
+	if closeWriter, ok := con.(interface{ CloseWrite() error }); ok {
+		closeWriter.CloseWrite()
+	}
+	io.CopyN(io.Discard, con, maxRefuseDrainSize)
+}
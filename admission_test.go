@@ -0,0 +1,115 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAdmission(t *testing.T) {
+	for _, item := range []struct {
+		config AdmissionConfig
+		err    error
+	}{
+		{AdmissionConfig{MaxConnectionCount: 1}, ConnectionLimitError},
+		{AdmissionConfig{MaxConnectionCountPerIP: 1}, IPConnectionLimitError},
+		{AdmissionConfig{MaxNewConnectionPerSecond: 1}, ConnectionRateLimitError},
+	} {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var refuseCount int32
+		serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+		serverObj.SetAdmissionConfig(item.config)
+		serverObj.AddRefuseConnectionHandler("Test", func(con net.Conn, err error) {
+			if errors.Is(err, item.err) {
+				atomic.AddInt32(&refuseCount, 1)
+			}
+		})
+		go serverObj.Start2(listener)
+
+		clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+		if err = clientObj.Start(listener.Addr().String(), false); err != nil {
+			t.Errorf("config:%+v first connection error:%v", item.config, err)
+		}
+
+		// 超过限制的连接在握手时被拒绝，并收到原因
+		refusedClientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+		err = refusedClientObj.Start(listener.Addr().String(), false)
+		if errors.Is(err, HandshakeRejectedError) == false || strings.Contains(err.Error(), item.err.Error()) == false {
+			t.Errorf("config:%+v should be refused error:%v", item.config, err)
+		}
+		if atomic.LoadInt32(&refuseCount) != 1 || serverObj.RefusedConnectionCount() != 1 {
+			t.Errorf("config:%+v refuse count:%v %v", item.config, refuseCount, serverObj.RefusedConnectionCount())
+		}
+
+		// 连接关闭后不再占用连接数
+		if item.config.MaxNewConnectionPerSecond == 0 {
+			clientObj.Close()
+			time.Sleep(50 * time.Millisecond)
+			newClientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+			if err = newClientObj.Start(listener.Addr().String(), false); err != nil {
+				t.Errorf("config:%+v connection after close error:%v", item.config, err)
+			}
+			newClientObj.Close()
+		}
+
+		clientObj.Close()
+		refusedClientObj.Close()
+		serverObj.Close()
+	}
+}
+
+func TestRefuseLimit(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+	serverObj.SetAdmissionConfig(AdmissionConfig{MaxConnectionCount: 1})
+	defer serverObj.Close()
+	go serverObj.Start2(listener)
+
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	if err = clientObj.Start(listener.Addr().String(), false); err != nil {
+		t.Errorf("first connection error:%v", err)
+	}
+	defer clientObj.Close()
+
+	// 正在发送拒绝原因的连接过多时直接关闭，对方收不到原因
+	atomic.StoreInt32(&serverObj.refusingCount, maxRefusingCount)
+	refusedClientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	if err = refusedClientObj.Start(listener.Addr().String(), false); err == nil || errors.Is(err, HandshakeRejectedError) {
+		t.Errorf("connection should be closed directly error:%v", err)
+	}
+	refusedClientObj.Close()
+
+	atomic.StoreInt32(&serverObj.refusingCount, 0)
+	refusedClientObj = NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	if err = refusedClientObj.Start(listener.Addr().String(), false); errors.Is(err, HandshakeRejectedError) == false || strings.Contains(err.Error(), ConnectionLimitError.Error()) == false {
+		t.Errorf("connection should be refused error:%v", err)
+	}
+	refusedClientObj.Close()
+
+	if serverObj.RefusedConnectionCount() != 2 {
+		t.Errorf("refuse count:%v", serverObj.RefusedConnectionCount())
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiterObj := &rateLimiter{rate: 2}
+	now := time.Now()
+	if limiterObj.allow(now) == false || limiterObj.allow(now) == false || limiterObj.allow(now) {
+		t.Errorf("burst not match")
+	}
+	if limiterObj.allow(now.Add(500*time.Millisecond)) == false || limiterObj.allow(now.Add(500*time.Millisecond)) {
+		t.Errorf("rate not match")
+	}
+}
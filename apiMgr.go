@@ -3,16 +3,19 @@ package rpc
 import (
 	"fmt"
 	"reflect"
+	"sort"
 
 	"github.com/polariseye/rpc-go/log"
 )
 
 type ApiMgr struct {
-	funcData map[string]*MethodInfo
+	funcData   map[string]*MethodInfo
+	methodData map[uint32]*MethodInfo //// key:方法Id
 }
 
 // 注册一个RPC服务端
-func (this *ApiMgr) RegisterService(obj interface{}) {
+// optionList:方法选项，可以使用ForMethod指定只对某个方法生效
+func (this *ApiMgr) RegisterService(obj interface{}, optionList ...MethodOption) {
 	tp := reflect.TypeOf(obj)
 	val := reflect.ValueOf(obj)
 	// 提取所有公有函数
@@ -22,7 +25,7 @@ func (this *ApiMgr) RegisterService(obj interface{}) {
 		mthd := tp.Method(i)
 		mthdVal := val.Method(i)
 
-		err := this.addRpcMethod(clsName, mthd.Name, mthd.Type, mthdVal, true)
+		err := this.addRpcMethod(clsName, mthd.Name, mthd.Type, mthdVal, true, optionList)
 		if err != nil {
 			panic(err)
 		}
@@ -41,17 +44,19 @@ func (this *ApiMgr) getClassName(tp reflect.Type) string {
 	return tp.Name()
 }
 
-func (this *ApiMgr) RegisterFunc(moduleName string, methodName string, funcObj interface{}) {
+// 注册一个RPC函数
+// optionList:方法选项
+func (this *ApiMgr) RegisterFunc(moduleName string, methodName string, funcObj interface{}, optionList ...MethodOption) {
 	tp := reflect.TypeOf(funcObj)
 	val := reflect.ValueOf(funcObj)
 
-	err := this.addRpcMethod(moduleName, methodName, tp, val, false)
+	err := this.addRpcMethod(moduleName, methodName, tp, val, false, optionList)
 	if err != nil {
 		panic(err)
 	}
 }
 
-func (this *ApiMgr) addRpcMethod(moduleName string, methodName string, methodType reflect.Type, methodVal reflect.Value, isFromStruct bool) error {
+func (this *ApiMgr) addRpcMethod(moduleName string, methodName string, methodType reflect.Type, methodVal reflect.Value, isFromStruct bool, optionList []MethodOption) error {
 	// 获取参数
 	paramList := make([]reflect.Type, 0, methodType.NumIn())
 	for i := 0; i < methodType.NumIn(); i++ {
@@ -70,25 +75,39 @@ func (this *ApiMgr) addRpcMethod(moduleName string, methodName string, methodTyp
 		returnList = append(returnList, methodType.Out(i))
 	}
 
-	// 第一个必须是连接对象类型的
+	// 第一个必须是连接对象类型的，第二个可以是context.Context，用于获取调用方的截止时间
 	if len(paramList) <= 0 || paramList[0] != RpcConnectionerType {
 		return fmt.Errorf("Param invalid ModuleName:%s MethodName:%s", moduleName, methodName)
 	}
 
-	/*
-		// 返回值最后一个必须是error
-		if len(returnList) <= 0 || returnList[len(returnList)-1] != ErrorType {
-			return errors.New("Return invalid ")
+	// 返回值最后一个如果是error，则会作为RPC错误返回给调用方
+	for i := 0; i < len(returnList)-1; i++ {
+		if returnList[i] == ErrorType {
+			return fmt.Errorf("Return invalid, error must be the last one ModuleName:%s MethodName:%s", moduleName, methodName)
 		}
-	*/
+	}
 
 	name := fmt.Sprintf("%s_%s", moduleName, methodName)
 	if _, exist := this.funcData[name]; exist {
 		return fmt.Errorf("rpc repeated:%s", name)
 	}
 
-	mthdInfoItem := newMethodInfo(name, methodVal, paramList, returnList)
+	// 方法Id由方法名计算得到，出现冲突时需要修改方法名
+	methodId := getMethodId(name)
+	if conflictItem, exist := this.methodData[methodId]; exist {
+		return fmt.Errorf("rpc method id conflict:%s methodId:%v conflict with:%v", name, methodId, conflictItem.MethodName)
+	}
+	if methodId == 0 {
+		return fmt.Errorf("rpc method id invalid:%s", name)
+	}
+
+	mthdInfoItem := newMethodInfo(name, methodName, methodVal, paramList, returnList)
+	mthdInfoItem.MethodId = methodId
+	for _, item := range optionList {
+		item(mthdInfoItem)
+	}
 	this.funcData[name] = mthdInfoItem
+	this.methodData[methodId] = mthdInfoItem
 
 	return nil
 }
@@ -99,14 +118,34 @@ func (this *ApiMgr) getMethod(methodName string) (*MethodInfo, bool) {
 	return result, exist
 }
 
+func (this *ApiMgr) getMethodById(methodId uint32) (*MethodInfo, bool) {
+	result, exist := this.methodData[methodId]
+
+	return result, exist
+}
+
+// getMethodNameList 获取所有方法名，握手时告知对方，对方确认方法名一致后才使用方法Id
+func (this *ApiMgr) getMethodNameList() []string {
+	result := make([]string, 0, len(this.methodData))
+	for _, methodObj := range this.methodData {
+		result = append(result, methodObj.MethodName)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
 func (this *ApiMgr) RecordAllMethod() {
 	for methodName, item := range this.funcData {
-		log.Debug("MethodName:%v ParamCount:%v ReturnCount:%v", methodName, len(item.funcParamList), len(item.returnValueList))
+		log.Debug("MethodName:%v MethodId:%v ParamCount:%v ReturnCount:%v", methodName, item.MethodId, len(item.funcParamList), len(item.returnValueList))
 	}
 }
 
 func newApiMgr() *ApiMgr {
-	return &ApiMgr{
-		funcData: make(map[string]*MethodInfo, 8),
+	result := &ApiMgr{
+		funcData:   make(map[string]*MethodInfo, 8),
+		methodData: make(map[uint32]*MethodInfo, 8),
 	}
+
+	return result
 }
@@ -0,0 +1,209 @@
+package rpc
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/polariseye/rpc-go/log"
+)
+
+// SetAttr 设置连接属性，可用于保存连接相关的状态，如登录后的用户Id，并发安全
+// 服务端通过AddAttrIndex添加索引的属性，可以使用FindConnections查找连接
+func (this *RpcConnection) SetAttr(key string, value interface{}) {
+	if this == nil {
+		return
+	}
+
+	this.attrLockObj.Lock()
+	defer this.attrLockObj.Unlock()
+
+	if this.attrData == nil {
+		this.attrData = make(map[string]interface{}, 4)
+	}
+	this.attrData[key] = value
+
+	if this.attrChangeFunc != nil {
+		this.attrChangeFunc(key, value, true)
+	}
+}
+
+// GetAttr 获取连接属性
+func (this *RpcConnection) GetAttr(key string) (value interface{}, exist bool) {
+	if this == nil {
+		return nil, false
+	}
+
+	this.attrLockObj.RLock()
+	defer this.attrLockObj.RUnlock()
+
+	value, exist = this.attrData[key]
+	return
+}
+
+// DeleteAttr 删除连接属性
+func (this *RpcConnection) DeleteAttr(key string) {
+	if this == nil {
+		return
+	}
+
+	this.attrLockObj.Lock()
+	defer this.attrLockObj.Unlock()
+
+	if _, exist := this.attrData[key]; exist == false {
+		return
+	}
+	delete(this.attrData, key)
+
+	if this.attrChangeFunc != nil {
+		this.attrChangeFunc(key, nil, false)
+	}
+}
+
+// 连接属性索引
+type attrIndex struct {
+	keyData   map[string]struct{}                                        //// 需要索引的属性
+	valueData map[string]map[interface{}]map[int64]*RpcConnection4Server //// key:属性 value:属性值对应的连接
+	connData  map[int64]map[string]interface{}                           //// key:连接Id value:连接已索引的属性值，用于连接关闭时移除
+	lockObj   sync.RWMutex
+}
+
+// addKey 添加需要索引的属性
+func (this *attrIndex) addKey(key string) {
+	this.lockObj.Lock()
+	defer this.lockObj.Unlock()
+
+	this.keyData[key] = struct{}{}
+}
+
+// update 更新连接的属性索引，在连接的属性锁内调用，已关闭的连接不再添加
+// isExist:属性是否存在，为false表示属性已删除
+func (this *attrIndex) update(connObj *RpcConnection4Server, key string, value interface{}, isExist bool) {
+	this.lockObj.Lock()
+	defer this.lockObj.Unlock()
+
+	if _, exist := this.keyData[key]; exist == false {
+		return
+	}
+
+	this.removeValue(connObj.ConnectionId(), key)
+	if isExist == false || connObj.IsClosed() {
+		return
+	}
+	if value != nil && reflect.TypeOf(value).Comparable() == false {
+		log.Warn("attr value can not be indexed key:%v type:%T", key, value)
+		return
+	}
+
+	connValueData, exist := this.valueData[key][value]
+	if exist == false {
+		if this.valueData[key] == nil {
+			this.valueData[key] = make(map[interface{}]map[int64]*RpcConnection4Server, 8)
+		}
+		connValueData = make(map[int64]*RpcConnection4Server, 1)
+		this.valueData[key][value] = connValueData
+	}
+	connValueData[connObj.ConnectionId()] = connObj
+
+	if this.connData[connObj.ConnectionId()] == nil {
+		this.connData[connObj.ConnectionId()] = make(map[string]interface{}, 1)
+	}
+	this.connData[connObj.ConnectionId()][key] = value
+}
+
+// remove 移除连接的所有属性索引，连接关闭时调用
+func (this *attrIndex) remove(connectionId int64) {
+	this.lockObj.Lock()
+	defer this.lockObj.Unlock()
+
+	for key := range this.connData[connectionId] {
+		this.removeValue(connectionId, key)
+	}
+}
+
+// removeValue 移除连接指定属性的索引，需要在锁内调用
+func (this *attrIndex) removeValue(connectionId int64, key string) {
+	oldValue, exist := this.connData[connectionId][key]
+	if exist == false {
+		return
+	}
+
+	delete(this.connData[connectionId], key)
+	if len(this.connData[connectionId]) == 0 {
+		delete(this.connData, connectionId)
+	}
+
+	delete(this.valueData[key][oldValue], connectionId)
+	if len(this.valueData[key][oldValue]) == 0 {
+		delete(this.valueData[key], oldValue)
+	}
+}
+
+// find 查找属性值对应的连接
+func (this *attrIndex) find(key string, value interface{}) (result []*RpcConnection4Server, isIndexed bool) {
+	this.lockObj.RLock()
+	defer this.lockObj.RUnlock()
+
+	if _, exist := this.keyData[key]; exist == false {
+		return nil, false
+	}
+	if value != nil && reflect.TypeOf(value).Comparable() == false {
+		return nil, true
+	}
+
+	for _, connObj := range this.valueData[key][value] {
+		result = append(result, connObj)
+	}
+
+	return result, true
+}
+
+func newAttrIndex() *attrIndex {
+	return &attrIndex{
+		keyData:   make(map[string]struct{}, 4),
+		valueData: make(map[string]map[interface{}]map[int64]*RpcConnection4Server, 4),
+		connData:  make(map[int64]map[string]interface{}, 8),
+	}
+}
+
+// AddAttrIndex 为连接属性添加索引，之后可以通过FindConnections快速查找，需要在Start前调用
+// 属性值需要是可比较的类型，查找时类型也需要一致，如int和int64是不同的值
+func (this *RpcServer) AddAttrIndex(key string) {
+	this.attrIndexObj.addKey(key)
+}
+
+// FindConnections 查找属性值为value的已握手成功的连接，有索引时使用索引，否则遍历所有连接
+func (this *RpcServer) FindConnections(key string, value interface{}) []*RpcConnection4Server {
+	connList, isIndexed := this.attrIndexObj.find(key, value)
+	if isIndexed == false {
+		connList = this.getConnectionList()
+	}
+
+	result := make([]*RpcConnection4Server, 0, len(connList))
+	for _, connObj := range connList {
+		if _, exist := this.GetConnection(connObj.ConnectionId()); exist == false {
+			// 还在握手或已关闭的连接
+			continue
+		}
+		if isIndexed == false {
+			if attrValue, exist := connObj.GetAttr(key); exist == false || isAttrEqual(attrValue, value) == false {
+				continue
+			}
+		}
+
+		result = append(result, connObj)
+	}
+
+	return result
+}
+
+// isAttrEqual 判断属性值是否相等，不可比较的类型使用reflect.DeepEqual
+func isAttrEqual(attrValue interface{}, value interface{}) bool {
+	if attrValue != nil && reflect.TypeOf(attrValue).Comparable() == false {
+		return reflect.DeepEqual(attrValue, value)
+	}
+	if value != nil && reflect.TypeOf(value).Comparable() == false {
+		return false
+	}
+
+	return attrValue == value
+}
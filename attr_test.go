@@ -0,0 +1,97 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestConnectionAttr(t *testing.T) {
+	connObj := &RpcConnection{}
+	if _, exist := connObj.GetAttr("userId"); exist {
+		t.Errorf("attr should not exist")
+	}
+
+	connObj.SetAttr("userId", 42)
+	if value, exist := connObj.GetAttr("userId"); exist == false || value != 42 {
+		t.Errorf("attr error value:%v exist:%v", value, exist)
+	}
+
+	connObj.DeleteAttr("userId")
+	if _, exist := connObj.GetAttr("userId"); exist {
+		t.Errorf("attr should be deleted")
+	}
+
+	var nilConnObj *RpcConnection
+	nilConnObj.SetAttr("userId", 42)
+	if _, exist := nilConnObj.GetAttr("userId"); exist {
+		t.Errorf("nil connection should not have attr")
+	}
+}
+
+func TestFindConnections(t *testing.T) {
+	addr := "mem://TestFindConnections"
+	listenerObj, err := listen(addr)
+	if err != nil {
+		t.Errorf("listen error:%v", err)
+		return
+	}
+
+	serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+	serverObj.AddAttrIndex("userId")
+	serverObj.RegisterFunc("Sample", "Login", func(connObj RpcConnectioner, userId int, name string) {
+		connObj.SetAttr("userId", userId)
+		connObj.SetAttr("name", name)
+	})
+	serverObj.RegisterFunc("Sample", "Logout", func(connObj RpcConnectioner) {
+		connObj.DeleteAttr("userId")
+	})
+	go serverObj.Start2(listenerObj)
+	defer serverObj.Close()
+
+	userIdList := []int{42, 42, 7}
+	clientList := make([]*RpcClient, 0, len(userIdList))
+	for _, userId := range userIdList {
+		clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+		if err = clientObj.Start(addr, false); err != nil {
+			t.Errorf("start error:%v", err)
+			return
+		}
+		defer clientObj.Close()
+
+		if err = clientObj.Call("Sample_Login", []interface{}{userId, "user"}, nil); err != nil {
+			t.Errorf("login error:%v", err)
+			return
+		}
+		clientList = append(clientList, clientObj)
+	}
+
+	checkCount := func(key string, value interface{}, expectCount int) {
+		if connList := serverObj.FindConnections(key, value); len(connList) != expectCount {
+			t.Errorf("find %v:%v count:%v expect:%v", key, value, len(connList), expectCount)
+		}
+	}
+	checkCount("userId", 42, 2)
+	checkCount("userId", 7, 1)
+	checkCount("userId", int64(42), 0)
+	checkCount("name", "user", 3)
+	checkCount("name", []int{1}, 0)
+
+	// 删除属性和关闭连接后，都需要从索引中移除
+	if err = clientList[0].Call("Sample_Logout", nil, nil); err != nil {
+		t.Errorf("logout error:%v", err)
+	}
+	checkCount("userId", 42, 1)
+
+	clientList[1].Close()
+	for i := 0; i < 100; i++ {
+		if connList, _ := serverObj.attrIndexObj.find("userId", 42); len(connList) == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if connList, _ := serverObj.attrIndexObj.find("userId", 42); len(connList) != 0 {
+		t.Errorf("index should be removed after close count:%v", len(connList))
+	}
+	checkCount("userId", 7, 1)
+}
@@ -0,0 +1,138 @@
+package rpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/polariseye/rpc-go/log"
+)
+
+// 广播调用的结果
+type BroadcastResult struct {
+	Connection  RpcConnectioner //// 连接对象
+	ReturnBytes []byte          //// 应答内容，可以使用UnMarshal反序列化
+	Err         error           //// 调用错误
+
+	getConvertorFunc func() IByteConvertor
+}
+
+// UnMarshal 把应答内容反序列化到responseObj中，调用出错时返回调用错误
+func (this *BroadcastResult) UnMarshal(responseObj ...interface{}) error {
+	if this.Err != nil {
+		return this.Err
+	}
+
+	return this.getConvertorFunc().UnMarhsalValue(this.ReturnBytes, responseObj...)
+}
+
+// 已结束的上下文，广播时发送队列已满的连接直接跳过，不会因为某个连接阻塞广播
+var noWaitCtx = func() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	return ctx
+}()
+
+// getBroadcastConnectionList 获取需要广播的连接
+// filter:过滤函数，返回true的连接才会广播，为nil则广播给所有连接
+func (this *RpcServer) getBroadcastConnectionList(filter func(connObj RpcConnectioner) bool) []*RpcConnection4Server {
+	connList := this.getConnectionList()
+	if filter == nil {
+		return connList
+	}
+
+	result := make([]*RpcConnection4Server, 0, len(connList))
+	for _, connObj := range connList {
+		if filter(connObj) {
+			result = append(result, connObj)
+		}
+	}
+
+	return result
+}
+
+// marshalRequest 序列化请求参数，所有连接共用序列化结果
+func (this *RpcServer) marshalRequest(requestObj []interface{}) ([]byte, error) {
+	if len(requestObj) == 0 {
+		return nil, nil
+	}
+
+	return this.getConvertorFunc().MarshalValue(requestObj...)
+}
+
+// Broadcast 向所有已握手成功的连接发送不需要应答的请求，请求参数只序列化一次
+// filter:过滤函数，返回true的连接才会发送，为nil则发送给所有连接
+// 返回值:
+// count:成功放入发送队列的连接数，发送队列已满的连接不会等待，也不计入
+// err:请求参数序列化错误
+func (this *RpcServer) Broadcast(methodName string, requestObj []interface{}, filter func(connObj RpcConnectioner) bool) (count int, err error) {
+	requestBytes, err := this.marshalRequest(requestObj)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, connObj := range this.getBroadcastConnectionList(filter) {
+		_, tmpErr := connObj.sendRequestBytes(noWaitCtx, methodName, requestBytes, nil, connObj.getExpireTime(connObj.requestExpireMillisecond), false)
+		if tmpErr != nil {
+			log.Debug("broadcast error methodname:%v ip:%v error:%v", methodName, connObj.Addr(), tmpErr)
+			continue
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// BroadcastCall 向所有已握手成功的连接发送请求，并等待所有应答，请求参数只序列化一次
+// filter:过滤函数，返回true的连接才会发送，为nil则发送给所有连接
+// expireMillisecond:超时时间，超时的连接返回CallTimeoutError
+// 发送队列已满的连接不会等待，直接返回SendQueueFullError，不会因为某个连接占用其他连接的超时时间
+// 返回值:
+// []*BroadcastResult:每个连接的应答
+// error:请求参数序列化错误
+func (this *RpcServer) BroadcastCall(methodName string, requestObj []interface{}, filter func(connObj RpcConnectioner) bool, expireMillisecond int64) ([]*BroadcastResult, error) {
+	requestBytes, err := this.marshalRequest(requestObj)
+	if err != nil {
+		return nil, err
+	}
+
+	connList := this.getBroadcastConnectionList(filter)
+	resultList := make([]*BroadcastResult, len(connList))
+	requestList := make([]*RequestInfo, len(connList))
+	expireTime := time.Now().UnixNano()/1000000 + expireMillisecond
+	for i, connObj := range connList {
+		resultList[i] = &BroadcastResult{
+			Connection:       connObj,
+			getConvertorFunc: this.getConvertorFunc,
+		}
+		requestList[i], resultList[i].Err = connObj.sendRequestBytes(noWaitCtx, methodName, requestBytes, nil, expireTime, true)
+	}
+
+	// 等待所有应答，超时后剩余的请求都返回超时
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(expireMillisecond)*time.Millisecond)
+	defer cancel()
+	for i, requestInfoObj := range requestList {
+		if requestInfoObj == nil {
+			continue
+		}
+
+		isTimeout := false
+		select {
+		case <-requestInfoObj.doneChan:
+		case <-ctx.Done():
+			if requestInfoObj.ReturnError(CallTimeoutError) {
+				connList[i].frameContainer.RemoveRequestObj(requestInfoObj.RequestId)
+				isTimeout = true
+			}
+		}
+
+		// 应答内容由抢占到应答权的一方在通知前写入，收到通知后再读取；超时时不读取应答内容
+		resultList[i].Err = <-requestInfoObj.DownChan
+		if isTimeout == false {
+			resultList[i].ReturnBytes = requestInfoObj.ReturnBytes
+		}
+	}
+
+	return resultList, nil
+}
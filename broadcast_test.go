@@ -0,0 +1,173 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 记录序列化次数的转换器
+type countConvertor struct {
+	IByteConvertor
+	marshalCount *int32
+}
+
+func (this *countConvertor) Name() string {
+	return getConvertorName(this.IByteConvertor)
+}
+
+func (this *countConvertor) MarshalValue(valueList ...interface{}) ([]byte, error) {
+	atomic.AddInt32(this.marshalCount, 1)
+	return this.IByteConvertor.MarshalValue(valueList...)
+}
+
+func TestBroadcast(t *testing.T) {
+	addr := "mem://TestBroadcast"
+	listenerObj, err := listen(addr)
+	if err != nil {
+		t.Errorf("listen error:%v", err)
+		return
+	}
+
+	var marshalCount int32
+	serverObj := NewRpcServer(binary.LittleEndian, func() IByteConvertor {
+		return &countConvertor{IByteConvertor: GetJsonConvertor(), marshalCount: &marshalCount}
+	})
+	go serverObj.Start2(listenerObj)
+	defer serverObj.Close()
+
+	// 第一个客户端会被过滤，第二个客户端应答超时
+	var pushCount int32
+	for i := 0; i < 3; i++ {
+		sleepTime := time.Duration(0)
+		if i == 1 {
+			sleepTime = 500 * time.Millisecond
+		}
+
+		clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+		clientObj.RegisterFunc("Client", "Push", func(connObj RpcConnectioner, value int) int {
+			atomic.AddInt32(&pushCount, 1)
+			time.Sleep(sleepTime)
+			return value + 1
+		})
+		if err = clientObj.Start(addr, false); err != nil {
+			t.Errorf("start error:%v", err)
+			return
+		}
+		defer clientObj.Close()
+	}
+	for i := 0; i < 100 && serverObj.GetConnectionCount() < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	firstConnectionId := serverObj.getConnectionList()[0].ConnectionId()
+	for _, connObj := range serverObj.getConnectionList() {
+		if connObj.ConnectionId() < firstConnectionId {
+			firstConnectionId = connObj.ConnectionId()
+		}
+	}
+	filter := func(connObj RpcConnectioner) bool {
+		return connObj.ConnectionId() != firstConnectionId
+	}
+
+	count, err := serverObj.Broadcast("Client_Push", []interface{}{1}, filter)
+	if err != nil || count != 2 {
+		t.Errorf("broadcast error:%v count:%v", err, count)
+	}
+
+	resultList, err := serverObj.BroadcastCall("Client_Push", []interface{}{1}, filter, 200)
+	if err != nil || len(resultList) != 2 {
+		t.Errorf("broadcast call error:%v count:%v", err, len(resultList))
+		return
+	}
+
+	var okCount, timeoutCount int
+	for _, item := range resultList {
+		var value int
+		if err = item.UnMarshal(&value); err == nil && value == 2 {
+			okCount++
+		} else if errors.Is(err, CallTimeoutError) && item.ReturnBytes == nil {
+			timeoutCount++
+		}
+	}
+	if okCount != 1 || timeoutCount != 1 {
+		t.Errorf("broadcast call result ok:%v timeout:%v", okCount, timeoutCount)
+	}
+	// 应答超时的客户端串行处理请求，此时还在处理第一次请求
+	if marshalCountValue, pushCountValue := atomic.LoadInt32(&marshalCount), atomic.LoadInt32(&pushCount); marshalCountValue != 2 || pushCountValue != 3 {
+		t.Errorf("marshal count:%v push count:%v", marshalCountValue, pushCountValue)
+	}
+}
+
+func TestBroadcastSendQueueFull(t *testing.T) {
+	listener := NewPipeListener("")
+	serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+	go serverObj.Start2(listener)
+	defer serverObj.Close()
+
+	newClient := func(con net.Conn) *RpcClient {
+		clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+		clientObj.RegisterFunc("Client", "Push", func(connObj RpcConnectioner, value int) int { return value + 1 })
+		if err := clientObj.Start2(con); err != nil {
+			t.Fatalf("start error:%v", err)
+		}
+
+		return clientObj
+	}
+	waitConnectionCount := func(count int) {
+		for i := 0; i < 100 && serverObj.GetConnectionCount() < count; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// 第一个客户端不再读取，服务端的发送队列被填满
+	con, _ := listener.Dial(context.Background(), "")
+	conObj := &pauseReadConn{Conn: con, resumeChan: make(chan struct{})}
+	fullClientObj := newClient(conObj)
+	defer fullClientObj.Close()
+	defer close(conObj.resumeChan)
+	waitConnectionCount(1)
+	atomic.StoreInt32(&conObj.isPaused, Yes)
+	for _, connObj := range serverObj.getConnectionList() {
+		fillSendQueue(connObj.RpcConnection)
+	}
+
+	con, _ = listener.Dial(context.Background(), "")
+	clientObj := newClient(con)
+	defer clientObj.Close()
+	waitConnectionCount(2)
+
+	// 发送队列已满的连接直接跳过
+	if count, err := serverObj.Broadcast("Client_Push", []interface{}{1}, nil); err != nil || count != 1 {
+		t.Errorf("broadcast count:%v error:%v", count, err)
+	}
+
+	// 发送队列已满的连接直接返回错误，不占用其他连接的超时时间
+	startTime := time.Now()
+	resultList, err := serverObj.BroadcastCall("Client_Push", []interface{}{1}, nil, 500)
+	if err != nil || len(resultList) != 2 {
+		t.Errorf("broadcast call error:%v result count:%v", err, len(resultList))
+		return
+	}
+	if costTime := time.Since(startTime); costTime > 2*time.Second {
+		t.Errorf("broadcast call cost time:%v", costTime)
+	}
+	var okCount, fullCount int
+	for _, resultObj := range resultList {
+		var value int
+		if err = resultObj.UnMarshal(&value); errors.Is(err, SendQueueFullError) {
+			fullCount++
+		} else if err == nil && value == 2 {
+			okCount++
+		} else {
+			t.Errorf("broadcast call result error:%v value:%v", err, value)
+		}
+	}
+	if okCount != 1 || fullCount != 1 {
+		t.Errorf("broadcast call ok count:%v full count:%v", okCount, fullCount)
+	}
+}
@@ -0,0 +1,68 @@
+package rpc
+
+import (
+	"hash"
+	"hash/crc32"
+	"io"
+	"sync/atomic"
+
+	"github.com/polariseye/rpc-go/log"
+)
+
+// 校验码长度，校验码为协议头、扩展字段、方法名和内容的CRC32，紧跟在内容之后
+const CHECKSUM_LENGTH = 4
+
+// SetChecksum 设置是否需要校验码，握手时告知对方，任意一方需要时双方发送的帧都会带上校验码
+// 需要在握手前设置，握手帧本身不带校验码
+func (this *RpcConnection) SetChecksum(isChecksum bool) {
+	if this == nil {
+		return
+	}
+
+	this.isChecksum = isChecksum
+}
+
+// ChecksumErrorCount 获取校验失败的帧数量
+func (this *RpcConnection) ChecksumErrorCount() int64 {
+	return atomic.LoadInt64(&this.checksumErrorCount)
+}
+
+// newChecksumReader 创建边读取边计算校验码的读取对象
+// header:已读取的协议头
+func (this *RpcConnection) newChecksumReader(header []byte) (io.Reader, hash.Hash32) {
+	hashObj := crc32.NewIEEE()
+	hashObj.Write(header)
+
+	return io.TeeReader(this.con, hashObj), hashObj
+}
+
+// receiveChecksum 读取校验码，并与计算得到的校验码比较
+func (this *RpcConnection) receiveChecksum(hashObj hash.Hash32) (isOk bool, err error) {
+	checksumBytes := make([]byte, CHECKSUM_LENGTH)
+	if _, err = io.ReadFull(this.con, checksumBytes); err != nil {
+		return false, err
+	}
+
+	return this.byteOrder.Uint32(checksumBytes) == hashObj.Sum32(), nil
+}
+
+// handleChecksumError 处理校验失败的帧，帧会被丢弃
+func (this *RpcConnection) handleChecksumError(frameObj *DataFrame) {
+	atomic.AddInt64(&this.checksumErrorCount, 1)
+	log.Warn("receive checksum error frame ip:%v requestFrameId:%v responseFrameId:%v", this.Addr(), frameObj.RequestFrameId, frameObj.ResponseFrameId)
+
+	this.rpcWatcherObj.afterChecksumError(frameObj)
+}
+
+// getChecksumBytes 计算帧的校验码
+func (this *RpcConnection) getChecksumBytes(dataList ...[]byte) []byte {
+	hashObj := crc32.NewIEEE()
+	for _, item := range dataList {
+		hashObj.Write(item)
+	}
+
+	result := make([]byte, CHECKSUM_LENGTH)
+	this.byteOrder.PutUint32(result, hashObj.Sum32())
+
+	return result
+}
@@ -0,0 +1,203 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// 写入时篡改内容的连接，用于模拟传输过程中的数据损坏
+type tamperConn struct {
+	net.Conn
+}
+
+func (this *tamperConn) Write(data []byte) (int, error) {
+	if bytes.Contains(data, []byte("corrupt")) {
+		if _, err := this.Conn.Write(bytes.Replace(data, []byte("corrupt"), []byte("CORRUPT"), -1)); err != nil {
+			return 0, err
+		}
+
+		return len(data), nil
+	}
+
+	return this.Conn.Write(data)
+}
+
+// 统计写入字节数的连接
+type countConn struct {
+	net.Conn
+	writeCount int64
+}
+
+func (this *countConn) Write(data []byte) (int, error) {
+	atomic.AddInt64(&this.writeCount, int64(len(data)))
+	return this.Conn.Write(data)
+}
+
+// newChecksumConnectionPair 创建设置了校验码和压缩的连接对
+func newChecksumConnectionPair(t *testing.T, apiMgr *ApiMgr, clientCon net.Conn, serverCon net.Conn, isClientChecksum bool, isServerChecksum bool, config CompressionConfig) (*RpcConnection4Server, *RpcClient) {
+	serverObj := newRpcConnection4Server(serverCon, apiMgr, binary.LittleEndian, GetJsonConvertor)
+	serverObj.SetChecksum(isServerChecksum)
+	serverObj.SetCompression(config)
+	serverObj.start()
+
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	clientObj.SetChecksum(isClientChecksum)
+	clientObj.SetCompression(config)
+	if err := clientObj.Start2(clientCon); err != nil {
+		serverObj.Close()
+		t.Fatalf("start error:%v", err)
+	}
+
+	return serverObj, clientObj
+}
+
+func TestChecksumNegotiate(t *testing.T) {
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Echo", func(connObj RpcConnectioner, value string) string { return value })
+
+	// 任意一方需要校验码时双方都发送校验码
+	for _, item := range [][2]bool{{true, false}, {false, true}, {false, false}} {
+		clientCon, serverCon := net.Pipe()
+		serverObj, clientObj := newChecksumConnectionPair(t, apiMgr, clientCon, serverCon, item[0], item[1], CompressionConfig{})
+		var checksumCount int32
+		serverObj.AddBeforeHandleFrameHandler("test", func(connObj RpcConnectioner, frameObj *DataFrame) (isHandled bool, err error) {
+			if frameObj.HasChecksum() {
+				atomic.AddInt32(&checksumCount, 1)
+			}
+			return
+		})
+
+		var value string
+		if err := clientObj.Call("Sample_Echo", []interface{}{"a"}, []interface{}{&value}); err != nil || value != "a" {
+			t.Errorf("client:%v server:%v call error:%v value:%v", item[0], item[1], err, value)
+		}
+
+		// 服务端处理请求前一定已完成握手
+		isChecksum := item[0] || item[1]
+		if serverObj.getNegotiated().isUseChecksum != isChecksum || clientObj.getNegotiated().isUseChecksum != isChecksum {
+			t.Errorf("client:%v server:%v negotiate checksum error", item[0], item[1])
+		}
+		if count := atomic.LoadInt32(&checksumCount); (count > 0) != isChecksum {
+			t.Errorf("client:%v server:%v checksum frame count:%v", item[0], item[1], count)
+		}
+
+		clientObj.Close()
+		serverObj.Close()
+	}
+}
+
+func TestChecksumError(t *testing.T) {
+	apiMgr := newApiMgr()
+	var callCount int32
+	apiMgr.RegisterFunc("Sample", "Echo", func(connObj RpcConnectioner, value string) string {
+		atomic.AddInt32(&callCount, 1)
+		return value
+	})
+
+	clientCon, serverCon := net.Pipe()
+	serverObj, clientObj := newChecksumConnectionPair(t, apiMgr, &tamperConn{Conn: clientCon}, serverCon, true, false, CompressionConfig{})
+	defer serverObj.Close()
+	defer clientObj.Close()
+
+	var errorCount int32
+	serverObj.AddChecksumErrorHandler("test", func(connObj RpcConnectioner, frameObj *DataFrame) {
+		atomic.AddInt32(&errorCount, 1)
+	})
+
+	// 损坏的帧被丢弃，不会调用处理函数，调用方等待超时
+	var value string
+	if err := clientObj.CallTimeout("Sample_Echo", []interface{}{"corrupt"}, []interface{}{&value}, 100); err != CallTimeoutError {
+		t.Errorf("expect CallTimeoutError but got:%v", err)
+	}
+
+	// 丢弃后连接依然可用
+	if err := clientObj.Call("Sample_Echo", []interface{}{"a"}, []interface{}{&value}); err != nil || value != "a" {
+		t.Errorf("call error:%v value:%v", err, value)
+	}
+	if serverObj.ChecksumErrorCount() != 1 || atomic.LoadInt32(&errorCount) != 1 || atomic.LoadInt32(&callCount) != 1 {
+		t.Errorf("checksum error count:%v handler count:%v call count:%v", serverObj.ChecksumErrorCount(), atomic.LoadInt32(&errorCount), atomic.LoadInt32(&callCount))
+	}
+}
+
+func TestChecksumMissing(t *testing.T) {
+	apiMgr := newApiMgr()
+	var callCount int32
+	apiMgr.RegisterFunc("Sample", "Echo", func(connObj RpcConnectioner, value string) string {
+		atomic.AddInt32(&callCount, 1)
+		return value
+	})
+
+	clientCon, serverCon := net.Pipe()
+	serverObj, clientObj := newChecksumConnectionPair(t, apiMgr, clientCon, serverCon, true, false, CompressionConfig{})
+	defer serverObj.Close()
+	defer clientObj.Close()
+
+	var errorCount int32
+	serverObj.AddChecksumErrorHandler("test", func(connObj RpcConnectioner, frameObj *DataFrame) {
+		atomic.AddInt32(&errorCount, 1)
+	})
+
+	var value string
+	if err := clientObj.Call("Sample_Echo", []interface{}{"a"}, []interface{}{&value}); err != nil || value != "a" {
+		t.Errorf("call error:%v value:%v", err, value)
+	}
+
+	// 协商使用校验码后，直接写入不带校验码的请求帧，服务端需要丢弃
+	bytesData, _ := GetJsonConvertor().MarshalValue("b")
+	frameObj := newRequestFrame(nil, "Sample_Echo", bytesData, 0x7FFFFFFF, false)
+	rawBytes := append(frameObj.GetHeader(binary.LittleEndian), frameObj.MethodNameBytes...)
+	rawBytes = append(rawBytes, frameObj.Data...)
+	if _, err := clientCon.Write(rawBytes); err != nil {
+		t.Errorf("write error:%v", err)
+		return
+	}
+
+	// 同一连接上的帧按顺序处理，后续请求完成时前面的帧已处理
+	if err := clientObj.Call("Sample_Echo", []interface{}{"c"}, []interface{}{&value}); err != nil || value != "c" {
+		t.Errorf("call error:%v value:%v", err, value)
+	}
+	if serverObj.ChecksumErrorCount() != 1 || atomic.LoadInt32(&errorCount) != 1 || atomic.LoadInt32(&callCount) != 2 {
+		t.Errorf("checksum error count:%v handler count:%v call count:%v", serverObj.ChecksumErrorCount(), atomic.LoadInt32(&errorCount), atomic.LoadInt32(&callCount))
+	}
+}
+
+func TestChecksumCompression(t *testing.T) {
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Echo", func(connObj RpcConnectioner, value string) string { return value })
+
+	clientCon, serverCon := net.Pipe()
+	countConnObj := &countConn{Conn: clientCon}
+	config := CompressionConfig{CompressorList: []ICompressor{NewGzipCompressor(-1)}, MinSize: 64}
+	serverObj, clientObj := newChecksumConnectionPair(t, apiMgr, countConnObj, serverCon, true, true, config)
+	defer serverObj.Close()
+	defer clientObj.Close()
+
+	var frameCount int32
+	serverObj.AddBeforeHandleFrameHandler("test", func(connObj RpcConnectioner, frameObj *DataFrame) (isHandled bool, err error) {
+		if frameObj.HasChecksum() && frameObj.MethodNameLen > 0 {
+			atomic.AddInt32(&frameCount, 1)
+		}
+		return
+	})
+
+	// 校验码按压缩后的内容计算，接收方先校验再解压
+	var value string
+	bigValue := strings.Repeat("abcdefgh", 128)
+	startCount := atomic.LoadInt64(&countConnObj.writeCount)
+	if err := clientObj.Call("Sample_Echo", []interface{}{bigValue}, []interface{}{&value}); err != nil || value != bigValue {
+		t.Errorf("call error:%v len:%v", err, len(value))
+	}
+	if writeCount := atomic.LoadInt64(&countConnObj.writeCount) - startCount; writeCount >= int64(len(bigValue)) {
+		t.Errorf("request not compressed, write count:%v", writeCount)
+	}
+	if count := atomic.LoadInt32(&frameCount); count != 1 {
+		t.Errorf("checksum frame count:%v", count)
+	}
+	if serverObj.ChecksumErrorCount() != 0 || clientObj.ChecksumErrorCount() != 0 {
+		t.Errorf("checksum error count server:%v client:%v", serverObj.ChecksumErrorCount(), clientObj.ChecksumErrorCount())
+	}
+}
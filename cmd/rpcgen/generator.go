@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/types"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const rpcImportPath = "github.com/polariseye/rpc-go"
+
+// 参数信息
+type paramInfo struct {
+	name     string
+	typeName string
+}
+
+// 服务方法信息
+type methodInfo struct {
+	name          string
+	connName      string      //// 连接参数名
+	ctxName       string      //// context.Context参数名，为空表示没有
+	paramList     []paramInfo //// 请求参数，不包含连接和context.Context
+	resultList    []string    //// 返回值类型，不包含最后的error
+	isReturnError bool        //// 最后一个返回值是否是error
+}
+
+// 生成器
+type generator struct {
+	packageName string
+	rpcName     string            //// rpc包在源文件中使用的名字
+	importData  map[string]string //// 生成代码需要的import，Key:包名 Value:导入路径
+	serviceList []*serviceInfo
+
+	clientPackageName string          //// 客户端代码的包名，为空则与服务端接口生成到同一个文件
+	clientDirName     string          //// 客户端代码所在的目录名，用于识别服务端源文件对客户端包的导入
+	localTypeData     map[string]bool //// 服务包内定义的类型，客户端在其他包时无法引用
+}
+
+// 服务信息
+type serviceInfo struct {
+	typeName   string
+	moduleName string
+	methodList []*methodInfo
+}
+
+// addService 从语法树中提取指定类型的RPC方法
+// fileList:同一个包内的所有文件
+// typeName:服务的结构体名
+// moduleName:注册时的模块名，RegisterService使用结构体名
+func (this *generator) addService(fileList []*ast.File, typeName string, moduleName string) error {
+	serviceObj := &serviceInfo{
+		typeName:   typeName,
+		moduleName: moduleName,
+	}
+
+	for _, fileObj := range fileList {
+		importData := getImportData(fileObj)
+		rpcName := ""
+		for name, path := range importData {
+			if path == rpcImportPath {
+				rpcName = name
+			}
+		}
+		if rpcName == "" {
+			continue
+		}
+
+		for _, declItem := range fileObj.Decls {
+			funcDecl, ok := declItem.(*ast.FuncDecl)
+			if ok == false || funcDecl.Recv == nil || funcDecl.Name.IsExported() == false {
+				continue
+			}
+			if getReceiverTypeName(funcDecl.Recv.List[0].Type) != typeName {
+				continue
+			}
+
+			methodObj, ok := this.parseMethod(funcDecl, rpcName, importData)
+			if ok == false {
+				continue
+			}
+
+			this.rpcName = rpcName
+			serviceObj.methodList = append(serviceObj.methodList, methodObj)
+		}
+	}
+
+	if len(serviceObj.methodList) == 0 {
+		return fmt.Errorf("no rpc method found for type:%v", typeName)
+	}
+
+	this.serviceList = append(this.serviceList, serviceObj)
+	return nil
+}
+
+// parseMethod 解析方法，第一个参数不是rpc.RpcConnectioner的方法会被忽略
+func (this *generator) parseMethod(funcDecl *ast.FuncDecl, rpcName string, importData map[string]string) (*methodInfo, bool) {
+	var paramList []paramInfo
+	index := 0
+	for _, field := range funcDecl.Type.Params.List {
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			// 不支持可变参数
+			return nil, false
+		}
+
+		typeName := types.ExprString(field.Type)
+		nameList := field.Names
+		if len(nameList) == 0 {
+			nameList = []*ast.Ident{nil}
+		}
+		for _, nameItem := range nameList {
+			name := fmt.Sprintf("p%d", index)
+			if nameItem != nil && nameItem.Name != "_" {
+				name = nameItem.Name
+			}
+
+			paramList = append(paramList, paramInfo{name: name, typeName: typeName})
+			this.addImport(field.Type, importData)
+			this.addLocalType(field.Type)
+			index++
+		}
+	}
+
+	if len(paramList) == 0 || paramList[0].typeName != rpcName+".RpcConnectioner" {
+		return nil, false
+	}
+
+	methodObj := &methodInfo{
+		name:     funcDecl.Name.Name,
+		connName: paramList[0].name,
+	}
+	paramList = paramList[1:]
+	if len(paramList) > 0 && paramList[0].typeName == importName(importData, "context")+".Context" {
+		methodObj.ctxName = paramList[0].name
+		paramList = paramList[1:]
+	}
+	methodObj.paramList = paramList
+
+	if funcDecl.Type.Results != nil {
+		for _, field := range funcDecl.Type.Results.List {
+			count := len(field.Names)
+			if count == 0 {
+				count = 1
+			}
+			for i := 0; i < count; i++ {
+				methodObj.resultList = append(methodObj.resultList, types.ExprString(field.Type))
+			}
+			this.addImport(field.Type, importData)
+			this.addLocalType(field.Type)
+		}
+	}
+	if len(methodObj.resultList) > 0 && methodObj.resultList[len(methodObj.resultList)-1] == "error" {
+		methodObj.isReturnError = true
+		methodObj.resultList = methodObj.resultList[:len(methodObj.resultList)-1]
+	}
+
+	return methodObj, true
+}
+
+// addImport 记录类型中引用到的包
+func (this *generator) addImport(expr ast.Expr, importData map[string]string) {
+	ast.Inspect(expr, func(node ast.Node) bool {
+		selectorExpr, ok := node.(*ast.SelectorExpr)
+		if ok == false {
+			return true
+		}
+
+		if identObj, ok := selectorExpr.X.(*ast.Ident); ok {
+			if path, exist := importData[identObj.Name]; exist {
+				this.importData[identObj.Name] = path
+			}
+		}
+
+		return false
+	})
+}
+
+// addLocalType 记录类型中引用到的服务包内定义的类型
+func (this *generator) addLocalType(expr ast.Expr) {
+	ast.Inspect(expr, func(node ast.Node) bool {
+		switch tp := node.(type) {
+		case *ast.SelectorExpr:
+			// 其他包的类型
+			return false
+		case *ast.Field:
+			// 只检查匿名结构体字段的类型，字段名不是类型
+			if tp.Type != nil {
+				this.addLocalType(tp.Type)
+			}
+			return false
+		case *ast.Ident:
+			if types.Universe.Lookup(tp.Name) == nil {
+				this.localTypeData[tp.Name] = true
+			}
+		}
+
+		return true
+	})
+}
+
+// setClientPackage 把客户端代码生成到其他包中，以便调用方导入使用
+// packageName:客户端代码的包名
+// dirName:客户端代码所在的目录名，服务端源文件导入的同名包会被视为客户端包本身
+func (this *generator) setClientPackage(packageName string, dirName string) {
+	this.clientPackageName = packageName
+	this.clientDirName = dirName
+}
+
+// isClientPackage 判断导入是否是客户端包本身
+func (this *generator) isClientPackage(name string, importPath string) bool {
+	return this.clientPackageName != "" && name == this.clientPackageName && path.Base(importPath) == this.clientDirName
+}
+
+// getClientTypeName 获取类型在客户端代码中的写法，客户端包自身的类型需要去掉包名
+func (this *generator) getClientTypeName(typeName string) string {
+	for name, importPath := range this.importData {
+		if this.isClientPackage(name, importPath) {
+			return regexp.MustCompile(`\b`+regexp.QuoteMeta(name)+`\.`).ReplaceAllString(typeName, "")
+		}
+	}
+
+	return typeName
+}
+
+// generate 生成代码，设置了客户端包时只生成服务端接口，客户端代码使用generateClientFile生成
+func (this *generator) generate() ([]byte, error) {
+	importData := make(map[string]string, len(this.importData)+2)
+	for name, importPath := range this.importData {
+		importData[name] = importPath
+	}
+
+	return this.generateFile(this.packageName, importData, true, this.clientPackageName == "")
+}
+
+// generateClientFile 生成客户端包中的客户端代码
+func (this *generator) generateClientFile() ([]byte, error) {
+	if len(this.localTypeData) > 0 && this.clientPackageName != this.packageName {
+		nameList := make([]string, 0, len(this.localTypeData))
+		for name := range this.localTypeData {
+			nameList = append(nameList, name)
+		}
+		sort.Strings(nameList)
+
+		return nil, fmt.Errorf("type %v declared in package %v can not be used by package %v, move it to a package both can import", strings.Join(nameList, ","), this.packageName, this.clientPackageName)
+	}
+
+	importData := make(map[string]string, len(this.importData)+2)
+	for name, importPath := range this.importData {
+		if this.isClientPackage(name, importPath) == false {
+			importData[name] = importPath
+		}
+	}
+
+	return this.generateFile(this.clientPackageName, importData, false, true)
+}
+
+// generateFile 生成一个文件
+// isServer:是否生成服务端接口
+// isClient:是否生成客户端代码
+func (this *generator) generateFile(packageName string, importData map[string]string, isServer bool, isClient bool) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "// Code generated by rpcgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "package %s\n\n", packageName)
+
+	importData[this.rpcName] = rpcImportPath
+	for _, serviceObj := range this.serviceList {
+		for _, methodObj := range serviceObj.methodList {
+			if methodObj.ctxName != "" {
+				importData["context"] = "context"
+			}
+		}
+	}
+
+	nameList := make([]string, 0, len(importData))
+	for name := range importData {
+		nameList = append(nameList, name)
+	}
+	sort.Slice(nameList, func(i, j int) bool {
+		return importData[nameList[i]] < importData[nameList[j]]
+	})
+	fmt.Fprintf(buf, "import (\n")
+	for _, name := range nameList {
+		importPath := importData[name]
+		if importPath == name || strings.HasSuffix(importPath, "/"+name) {
+			fmt.Fprintf(buf, "\t%s\n", strconv.Quote(importPath))
+		} else {
+			fmt.Fprintf(buf, "\t%s %s\n", name, strconv.Quote(importPath))
+		}
+	}
+	fmt.Fprintf(buf, ")\n")
+
+	for _, serviceObj := range this.serviceList {
+		if isServer {
+			this.generateServer(buf, serviceObj)
+		}
+		if isClient {
+			this.generateClient(buf, serviceObj)
+		}
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+// generateServer 生成服务端需要实现的接口
+func (this *generator) generateServer(buf *bytes.Buffer, serviceObj *serviceInfo) {
+	fmt.Fprintf(buf, "\n// %sServer %s服务需要实现的接口\n", serviceObj.typeName, serviceObj.typeName)
+	fmt.Fprintf(buf, "type %sServer interface {\n", serviceObj.typeName)
+	for _, methodObj := range serviceObj.methodList {
+		paramList := []string{methodObj.connName + " " + this.rpcName + ".RpcConnectioner"}
+		if methodObj.ctxName != "" {
+			paramList = append(paramList, methodObj.ctxName+" context.Context")
+		}
+		for _, item := range methodObj.paramList {
+			paramList = append(paramList, item.name+" "+item.typeName)
+		}
+
+		resultList := append([]string{}, methodObj.resultList...)
+		if methodObj.isReturnError {
+			resultList = append(resultList, "error")
+		}
+
+		fmt.Fprintf(buf, "\t%s(%s)%s\n", methodObj.name, strings.Join(paramList, ", "), formatResultList(resultList))
+	}
+	fmt.Fprintf(buf, "}\n\n")
+
+	// 服务端方法有变化时，编译会报错
+	fmt.Fprintf(buf, "var _ %sServer = (*%s)(nil)\n", serviceObj.typeName, serviceObj.typeName)
+}
+
+// generateClient 生成客户端调用代码
+func (this *generator) generateClient(buf *bytes.Buffer, serviceObj *serviceInfo) {
+	clientName := serviceObj.typeName + "Client"
+	fmt.Fprintf(buf, "\n// %s %s服务的客户端\n", clientName, serviceObj.typeName)
+	fmt.Fprintf(buf, "type %s struct {\n\tconnObj %s.RpcConnectioner\n}\n\n", clientName, this.rpcName)
+	fmt.Fprintf(buf, "// New%s 新建%s服务的客户端\n", clientName, serviceObj.typeName)
+	fmt.Fprintf(buf, "func New%s(connObj %s.RpcConnectioner) *%s {\n\treturn &%s{\n\t\tconnObj: connObj,\n\t}\n}\n", clientName, this.rpcName, clientName, clientName)
+
+	for _, methodObj := range serviceObj.methodList {
+		// 避免参数名和生成的变量名冲突
+		usedData := map[string]bool{"this": true, "err": true}
+		paramList := make([]string, 0, len(methodObj.paramList)+1)
+		ctxName := ""
+		if methodObj.ctxName != "" {
+			ctxName = getUniqueName(methodObj.ctxName, usedData)
+			paramList = append(paramList, ctxName+" context.Context")
+		}
+		argList := make([]string, 0, len(methodObj.paramList))
+		for _, item := range methodObj.paramList {
+			name := getUniqueName(item.name, usedData)
+			paramList = append(paramList, name+" "+this.getClientTypeName(item.typeName))
+			argList = append(argList, name)
+		}
+
+		resultList := make([]string, 0, len(methodObj.resultList))
+		for _, typeName := range methodObj.resultList {
+			resultList = append(resultList, this.getClientTypeName(typeName))
+		}
+
+		resultNameList := make([]string, 0, len(methodObj.resultList))
+		responseList := make([]string, 0, len(methodObj.resultList))
+		for i := range resultList {
+			name := getUniqueName(fmt.Sprintf("result%d", i), usedData)
+			resultNameList = append(resultNameList, name)
+		}
+
+		fmt.Fprintf(buf, "\nfunc (this *%s) %s(%s)%s {\n", clientName, methodObj.name, strings.Join(paramList, ", "), formatResultList(append(append([]string{}, resultList...), "error")))
+		for i, typeName := range resultList {
+			if strings.HasPrefix(typeName, "*") {
+				// 指针类型需要先创建对象，以便ProtobufConvertor等转换器直接反序列化到消息中
+				fmt.Fprintf(buf, "\t%s := new(%s)\n", resultNameList[i], typeName[1:])
+				responseList = append(responseList, resultNameList[i])
+			} else {
+				fmt.Fprintf(buf, "\tvar %s %s\n", resultNameList[i], typeName)
+				responseList = append(responseList, "&"+resultNameList[i])
+			}
+		}
+
+		requestExpr := "nil"
+		if len(argList) > 0 {
+			requestExpr = "[]interface{}{" + strings.Join(argList, ", ") + "}"
+		}
+		responseExpr := "nil"
+		if len(responseList) > 0 {
+			responseExpr = "[]interface{}{" + strings.Join(responseList, ", ") + "}"
+		}
+
+		methodName := strconv.Quote(serviceObj.moduleName + "_" + methodObj.name)
+		if ctxName != "" {
+			fmt.Fprintf(buf, "\terr := this.connObj.CallContext(%s, %s, %s, %s)\n", ctxName, methodName, requestExpr, responseExpr)
+		} else {
+			fmt.Fprintf(buf, "\terr := this.connObj.Call(%s, %s, %s)\n", methodName, requestExpr, responseExpr)
+		}
+		fmt.Fprintf(buf, "\treturn %s\n}\n", strings.Join(append(resultNameList, "err"), ", "))
+	}
+}
+
+// getImportData 获取文件的import信息，Key:包名 Value:导入路径
+func getImportData(fileObj *ast.File) map[string]string {
+	result := make(map[string]string, len(fileObj.Imports))
+	for _, item := range fileObj.Imports {
+		path, err := strconv.Unquote(item.Path.Value)
+		if err != nil {
+			continue
+		}
+
+		name := path[strings.LastIndex(path, "/")+1:]
+		if path == rpcImportPath {
+			name = "rpc"
+		}
+		if item.Name != nil {
+			name = item.Name.Name
+		}
+
+		result[name] = path
+	}
+
+	return result
+}
+
+// importName 获取导入路径对应的包名，没有导入则返回导入路径
+func importName(importData map[string]string, path string) string {
+	for name, item := range importData {
+		if item == path {
+			return name
+		}
+	}
+
+	return path
+}
+
+// getReceiverTypeName 获取接收者的类型名
+func getReceiverTypeName(expr ast.Expr) string {
+	switch tp := expr.(type) {
+	case *ast.StarExpr:
+		return getReceiverTypeName(tp.X)
+	case *ast.Ident:
+		return tp.Name
+	default:
+		return ""
+	}
+}
+
+// getUniqueName 获取不重复的变量名
+func getUniqueName(name string, usedData map[string]bool) string {
+	for usedData[name] {
+		name = name + "_"
+	}
+	usedData[name] = true
+
+	return name
+}
+
+func formatResultList(resultList []string) string {
+	switch len(resultList) {
+	case 0:
+		return ""
+	case 1:
+		return " " + resultList[0]
+	default:
+		return " (" + strings.Join(resultList, ", ") + ")"
+	}
+}
+
+func newGenerator(packageName string) *generator {
+	return &generator{
+		packageName:   packageName,
+		importData:    make(map[string]string, 4),
+		localTypeData: make(map[string]bool, 4),
+	}
+}
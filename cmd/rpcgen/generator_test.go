@@ -0,0 +1,160 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+const sampleSource = `package sample
+
+import (
+	"context"
+
+	"github.com/polariseye/rpc-go"
+)
+
+type Sample struct {
+}
+
+func (this *Sample) VoidTst(connObj rpc.RpcConnectioner) {
+}
+
+func (this *Sample) StringTst3(connObj rpc.RpcConnectioner, name string, name2 string) (string, string) {
+	return name, name2
+}
+
+func (this *Sample) ErrorTst(connObj rpc.RpcConnectioner, ctx context.Context, man *Man) (*Man, error) {
+	return man, nil
+}
+
+func (this *Sample) notRpc(connObj rpc.RpcConnectioner) {
+}
+
+func (this *Sample) NotRpc2(name string) {
+}
+
+type Man struct {
+	Name string
+}
+`
+
+func TestGenerate(t *testing.T) {
+	fileSet := token.NewFileSet()
+	fileObj, err := parser.ParseFile(fileSet, "sample.go", sampleSource, 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	generatorObj := newGenerator("sample")
+	if err = generatorObj.addService([]*ast.File{fileObj}, "Sample", "Sample"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	bytesData, err := generatorObj.generate()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	code := string(bytesData)
+	for _, item := range []string{
+		`StringTst3(connObj rpc.RpcConnectioner, name string, name2 string) (string, string)`,
+		`ErrorTst(connObj rpc.RpcConnectioner, ctx context.Context, man *Man) (*Man, error)`,
+		`func (this *SampleClient) StringTst3(name string, name2 string) (string, string, error)`,
+		`func (this *SampleClient) ErrorTst(ctx context.Context, man *Man) (*Man, error)`,
+		`func (this *SampleClient) VoidTst() error`,
+		`this.connObj.Call("Sample_StringTst3", []interface{}{name, name2}, []interface{}{&result0, &result1})`,
+		`this.connObj.CallContext(ctx, "Sample_ErrorTst", []interface{}{man}, []interface{}{result0})`,
+		`var _ SampleServer = (*Sample)(nil)`,
+	} {
+		if strings.Contains(code, item) == false {
+			t.Errorf("generated code not contains:%v\n%v", item, code)
+			return
+		}
+	}
+
+	if strings.Contains(code, "notRpc") || strings.Contains(code, "NotRpc2") {
+		t.Errorf("generated code contains non rpc method\n%v", code)
+	}
+}
+
+const clientPackageSource = `package main
+
+import (
+	"github.com/polariseye/rpc-go"
+	"github.com/polariseye/rpc-go/rpcTst/sampleapi"
+)
+
+type Sample struct {
+}
+
+func (this *Sample) StructTst(connObj rpc.RpcConnectioner, man *sampleapi.Man) []sampleapi.Man {
+	return nil
+}
+`
+
+func TestGenerateClientPackage(t *testing.T) {
+	fileSet := token.NewFileSet()
+	fileObj, err := parser.ParseFile(fileSet, "sample.go", clientPackageSource, 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	generatorObj := newGenerator("main")
+	generatorObj.setClientPackage("sampleapi", "sampleapi")
+	if err = generatorObj.addService([]*ast.File{fileObj}, "Sample", "Sample"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// 服务端只生成接口
+	bytesData, err := generatorObj.generate()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	code := string(bytesData)
+	if strings.Contains(code, `StructTst(connObj rpc.RpcConnectioner, man *sampleapi.Man) []sampleapi.Man`) == false || strings.Contains(code, "SampleClient") {
+		t.Errorf("server code not match\n%v", code)
+	}
+
+	// 客户端生成到sampleapi包中，不再导入自身
+	if bytesData, err = generatorObj.generateClientFile(); err != nil {
+		t.Error(err)
+		return
+	}
+	code = string(bytesData)
+	for _, item := range []string{
+		`package sampleapi`,
+		`func (this *SampleClient) StructTst(man *Man) ([]Man, error)`,
+	} {
+		if strings.Contains(code, item) == false {
+			t.Errorf("client code not contains:%v\n%v", item, code)
+		}
+	}
+	if strings.Contains(code, "rpcTst/sampleapi") || strings.Contains(code, "SampleServer") {
+		t.Errorf("client code should not import itself or contain server\n%v", code)
+	}
+
+	// 服务包内定义的类型无法在客户端包中使用
+	fileObj, err = parser.ParseFile(fileSet, "sample.go", sampleSource, 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	generatorObj = newGenerator("sample")
+	generatorObj.setClientPackage("sampleapi", "sampleapi")
+	if err = generatorObj.addService([]*ast.File{fileObj}, "Sample", "Sample"); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = generatorObj.generateClientFile(); err == nil || strings.Contains(err.Error(), "Man") == false {
+		t.Errorf("expect local type error but got:%v", err)
+	}
+}
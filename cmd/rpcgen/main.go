@@ -0,0 +1,134 @@
+// rpcgen 根据服务结构体生成类型安全的客户端和服务端接口
+//
+// 用法:在服务结构体所在的文件中添加
+//
+//	//go:generate go run github.com/polariseye/rpc-go/cmd/rpcgen -type Sample
+//
+// 会生成sample_rpc.go，其中包含:
+//  1. SampleServer:服务端需要实现的接口，Sample的方法有变化时编译会报错
+//  2. SampleClient:客户端调用对象，如SampleClient.StringTst3(name, name2) (string, string, error)
+//
+// 服务结构体在main包等无法导入的包中时，可以使用-out和-pkg把客户端生成到其他包中:
+//
+//	//go:generate go run github.com/polariseye/rpc-go/cmd/rpcgen -type Sample -out ../sampleapi/sample_client.go -pkg sampleapi
+//
+// 此时方法中用到的类型需要定义在双方都能导入的包中
+//
+// 只有第一个参数是rpc.RpcConnectioner的公有方法才会生成
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	typeNames  = flag.String("type", "", "服务结构体名，多个以逗号分隔，必填")
+	moduleName = flag.String("module", "", "注册时的模块名，默认为结构体名(与RegisterService一致)，只在-type为单个结构体时有效")
+	output     = flag.String("output", "", "输出文件名，默认为<第一个结构体名小写>_rpc.go")
+	dir        = flag.String("dir", ".", "服务结构体所在的目录")
+	clientOut  = flag.String("out", "", "客户端代码的输出文件(相对于-dir)，为空则客户端与服务端接口生成到同一个文件")
+	clientPkg  = flag.String("pkg", "", "客户端代码的包名，默认为-out所在的目录名，只在设置了-out时有效")
+)
+
+func main() {
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "rpcgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	typeNameList := strings.Split(*typeNames, ",")
+	outputFile := *output
+	if outputFile == "" {
+		outputFile = strings.ToLower(typeNameList[0]) + "_rpc.go"
+	}
+	outputFile = filepath.Join(*dir, outputFile)
+
+	clientFile := ""
+	clientFileName := "" //// 客户端代码与服务结构体在同一目录时，解析时需要排除
+	if *clientOut != "" {
+		clientFile = filepath.Join(*dir, *clientOut)
+		if filepath.Dir(clientFile) == filepath.Clean(*dir) {
+			clientFileName = filepath.Base(clientFile)
+		}
+	}
+
+	// 解析目录下的所有文件(不包含测试文件和输出文件)
+	fileSet := token.NewFileSet()
+	packageData, err := parser.ParseDir(fileSet, *dir, func(fileInfo os.FileInfo) bool {
+		return strings.HasSuffix(fileInfo.Name(), "_test.go") == false && fileInfo.Name() != filepath.Base(outputFile) && fileInfo.Name() != clientFileName
+	}, 0)
+	if err != nil {
+		return err
+	}
+	if len(packageData) != 1 {
+		return fmt.Errorf("expect one package in dir:%v but got:%v", *dir, len(packageData))
+	}
+
+	for packageName, packageObj := range packageData {
+		fileList := make([]*ast.File, 0, len(packageObj.Files))
+		for _, fileObj := range packageObj.Files {
+			fileList = append(fileList, fileObj)
+		}
+
+		generatorObj := newGenerator(packageName)
+		if clientFile != "" {
+			clientDir, err := filepath.Abs(filepath.Dir(clientFile))
+			if err != nil {
+				return err
+			}
+
+			clientPackageName := *clientPkg
+			if clientPackageName == "" {
+				clientPackageName = filepath.Base(clientDir)
+			}
+			generatorObj.setClientPackage(clientPackageName, filepath.Base(clientDir))
+		}
+
+		for _, typeName := range typeNameList {
+			typeName = strings.TrimSpace(typeName)
+			module := typeName
+			if *moduleName != "" && len(typeNameList) == 1 {
+				module = *moduleName
+			}
+
+			if err = generatorObj.addService(fileList, typeName, module); err != nil {
+				return err
+			}
+		}
+
+		bytesData, err := generatorObj.generate()
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(outputFile, bytesData, 0644); err != nil {
+			return err
+		}
+		if clientFile == "" {
+			return nil
+		}
+
+		// 客户端代码生成到其他包中
+		if bytesData, err = generatorObj.generateClientFile(); err != nil {
+			return err
+		}
+
+		return os.WriteFile(clientFile, bytesData, 0644)
+	}
+
+	return nil
+}
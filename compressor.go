@@ -0,0 +1,213 @@
+package rpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/polariseye/rpc-go/log"
+)
+
+// 压缩算法，压缩只针对内容，不包含方法名
+type ICompressor interface {
+	// Name 压缩算法名称，握手时用于协商，双方需要一致
+	Name() string
+
+	Compress(data []byte) ([]byte, error)
+
+	// Decompress 解压
+	// maxSize:解压后的最大长度，超过时返回FrameTooLargeError，0表示不限制
+	Decompress(data []byte, maxSize int) ([]byte, error)
+}
+
+// 压缩配置
+type CompressionConfig struct {
+	CompressorList []ICompressor //// 支持的压缩算法，按优先级排列，为空表示不压缩
+	MinSize        int           //// 内容长度小于此值时不压缩，建议为1024
+}
+
+// getCompressorNameList 获取压缩算法名称列表，握手时告知对方
+func (this *CompressionConfig) getCompressorNameList() []string {
+	result := make([]string, 0, len(this.CompressorList))
+	for _, item := range this.CompressorList {
+		result = append(result, item.Name())
+	}
+
+	return result
+}
+
+// findCompressor 查找指定名称的压缩算法
+func findCompressor(compressorList []ICompressor, name string) ICompressor {
+	for _, item := range compressorList {
+		if item.Name() == name {
+			return item
+		}
+	}
+
+	return nil
+}
+
+// negotiateCompressor 协商压缩算法，双方都按发送方的优先级选择，所以不需要在帧中标明压缩算法
+// 返回值:
+// sendCompressor:本方发送时使用的压缩算法，为本方优先级最高且对方支持的算法
+// receiveCompressor:对方发送时使用的压缩算法，为对方优先级最高且本方支持的算法
+func negotiateCompressor(compressorList []ICompressor, peerNameList []string) (sendCompressor ICompressor, receiveCompressor ICompressor) {
+	for _, item := range compressorList {
+		for _, name := range peerNameList {
+			if item.Name() == name {
+				sendCompressor = item
+				break
+			}
+		}
+		if sendCompressor != nil {
+			break
+		}
+	}
+
+	for _, name := range peerNameList {
+		if receiveCompressor = findCompressor(compressorList, name); receiveCompressor != nil {
+			break
+		}
+	}
+
+	return
+}
+
+// SetCompression 设置压缩配置，需要在握手前设置，握手时与对方协商压缩算法
+func (this *RpcConnection) SetCompression(config CompressionConfig) {
+	if this == nil {
+		return
+	}
+
+	this.compressionConfig = config
+}
+
+// compressFrame 压缩帧内容，只压缩长度达到MinSize的正常帧，压缩失败或没有变小时不压缩
+func (this *RpcConnection) compressFrame(frameObj *DataFrame) {
+	frameObj.SetCompressed(false)
+	sendCompressor := this.getNegotiated().sendCompressor
+	if sendCompressor == nil || frameObj.TransformType() != TransformType_Nomal || int(frameObj.ContentLength) < this.compressionConfig.MinSize || frameObj.ContentLength == 0 {
+		return
+	}
+
+	bytesData, err := sendCompressor.Compress(frameObj.Data)
+	if err != nil {
+		log.Warn("compress error ip:%v compressor:%v error:%v", this.Addr(), sendCompressor.Name(), err)
+		return
+	}
+	if len(bytesData) >= len(frameObj.Data) {
+		return
+	}
+
+	frameObj.Data = bytesData
+	frameObj.ContentLength = uint32(len(bytesData))
+	frameObj.SetCompressed(true)
+}
+
+// decompressFrame 解压帧内容，解压后的长度不能超过最大帧长度
+func (this *RpcConnection) decompressFrame(frameObj *DataFrame) error {
+	receiveCompressor := this.getNegotiated().receiveCompressor
+	if receiveCompressor == nil {
+		return fmt.Errorf("%w:no compressor negotiated", InnerDataError)
+	}
+
+	bytesData, err := receiveCompressor.Decompress(frameObj.Data, int(this.maxFrameSize))
+	if err != nil {
+		if errors.Is(err, FrameTooLargeError) {
+			return err
+		}
+
+		return fmt.Errorf("%w:%v", InnerDataError, err)
+	}
+
+	frameObj.Data = bytesData
+	frameObj.ContentLength = uint32(len(bytesData))
+	frameObj.SetCompressed(false)
+
+	return nil
+}
+
+// handleDecompressError 处理解压失败的帧，返回error则关闭连接
+// 请求帧应答错误，应答帧则让对应的请求返回错误
+func (this *RpcConnection) handleDecompressError(frameObj *DataFrame, err error) error {
+	log.Warn("decompress error ip:%v error:%v", this.Addr(), err)
+	if errors.Is(err, FrameTooLargeError) {
+		this.rpcWatcherObj.afterOversizeFrame(frameObj)
+		if this.frameSizeAction == FrameSizeAction_Close {
+			return err
+		}
+	}
+	if frameObj.TransformType() != TransformType_Nomal {
+		return err
+	}
+
+	if frameObj.ResponseFrameId != 0 {
+		if requestObj, exist := this.frameContainer.GetRequestInfo(frameObj.ResponseFrameId); exist {
+			requestObj.ReturnError(err)
+		}
+
+		return nil
+	}
+
+	this.response(frameObj, nil, err)
+	return nil
+}
+
+// gzip压缩
+type GzipCompressor struct {
+	level int
+}
+
+func (this *GzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (this *GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buffer, this.level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func (this *GzipCompressor) Decompress(data []byte, maxSize int) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	if maxSize <= 0 {
+		return io.ReadAll(reader)
+	}
+
+	// 多读一个字节，用于判断是否超长
+	result, err := io.ReadAll(io.LimitReader(reader, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(result) > maxSize {
+		return nil, FrameTooLargeError
+	}
+
+	return result, nil
+}
+
+// NewGzipCompressor 新建gzip压缩
+// level:压缩级别，如gzip.DefaultCompression
+func NewGzipCompressor(level int) *GzipCompressor {
+	return &GzipCompressor{
+		level: level,
+	}
+}
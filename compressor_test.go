@@ -0,0 +1,42 @@
+package rpc
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestGzipCompressor(t *testing.T) {
+	compressorObj := NewGzipCompressor(-1)
+	data := bytes.Repeat([]byte("abcdefgh"), 128)
+
+	compressedData, err := compressorObj.Compress(data)
+	if err != nil || len(compressedData) >= len(data) {
+		t.Errorf("compress error:%v len:%v", err, len(compressedData))
+		return
+	}
+
+	result, err := compressorObj.Decompress(compressedData, len(data))
+	if err != nil || bytes.Equal(result, data) == false {
+		t.Errorf("decompress error:%v len:%v", err, len(result))
+		return
+	}
+
+	if _, err = compressorObj.Decompress(compressedData, len(data)-1); errors.Is(err, FrameTooLargeError) == false {
+		t.Errorf("decompress should be too large error:%v", err)
+	}
+}
+
+func TestNegotiateCompressor(t *testing.T) {
+	gzipObj := NewGzipCompressor(-1)
+	otherObj := &GzipCompressor{}
+	sendCompressor, receiveCompressor := negotiateCompressor([]ICompressor{gzipObj}, []string{"zstd", "gzip"})
+	if sendCompressor != gzipObj || receiveCompressor != gzipObj {
+		t.Errorf("negotiate error send:%v receive:%v", sendCompressor, receiveCompressor)
+	}
+
+	sendCompressor, receiveCompressor = negotiateCompressor([]ICompressor{otherObj}, []string{"zstd"})
+	if sendCompressor != nil || receiveCompressor != nil {
+		t.Errorf("should not negotiate send:%v receive:%v", sendCompressor, receiveCompressor)
+	}
+}
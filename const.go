@@ -1,6 +1,7 @@
 package rpc
 
 import (
+	"context"
 	"errors"
 	"reflect"
 )
@@ -14,6 +15,21 @@ const (
 
 	// 协议头字节数
 	HEADER_LENGTH = 16
+
+	// V2协议头字节，方法名长度为2字节
+	HEADER_V2 byte = 0x0A
+
+	// V2协议头字节数
+	HEADER_LENGTH_V2 = 17
+)
+
+// 协议头版本
+const (
+	// 方法名最长255字节
+	HeaderVersion_V1 byte = 1
+
+	// 方法名最长65535字节
+	HeaderVersion_V2 byte = 2
 )
 
 // Flag信息
@@ -23,11 +39,30 @@ const (
 
 	// 心跳
 	TransformType_KeepAlive byte = 0x01
+
+	// 握手，协议头固定使用大端
+	TransformType_Hello byte = 0x02
+
+	// 即将关闭连接，收到后不再发送新请求
+	TransformType_GoAway byte = 0x03
+)
+
+// 协议版本，握手时双方需要一致
+const ProtocolVersion = 1
+
+// 扩展字段Key，扩展字段格式：{ExtendLength:2Byte}{{Key:1Byte}{Len:1Byte}{Value}}...
+const (
+	// 请求剩余的超时时长(单位：毫秒) 4Byte
+	ExtendKey_Timeout byte = 0x01
+
+	// 方法Id 4Byte，带有方法Id时可以不发送方法名
+	ExtendKey_MethodId byte = 0x02
 )
 
 var (
 	RpcConnectionerType = reflect.TypeOf((*RpcConnectioner)(nil)).Elem()
 	ErrorType           = reflect.TypeOf((*error)(nil)).Elem() //// 这里必须用指针，否则提示为Nil
+	ContextType         = reflect.TypeOf((*context.Context)(nil)).Elem()
 )
 
 var (
@@ -41,6 +76,24 @@ var (
 	NotSupportedTypeError    = errors.New("NotSupportedTypeError")
 	InnerDataError           = errors.New("InnerDataError")
 	ConnectionClosedError    = errors.New("ConnectionClosedError")
+	ServerBusyError          = errors.New("ServerBusyError")
+	ParamDecodeError         = errors.New("ParamDecodeError")
+	HandlerPanicError        = errors.New("HandlerPanicError")
+	OrderKeyError            = errors.New("OrderKeyError")
+	MethodNameTooLongError   = errors.New("MethodNameTooLongError")
+	HandshakeError           = errors.New("HandshakeError")
+	HandshakeRejectedError   = errors.New("HandshakeRejectedError")
+	HandshakeTimeoutError    = errors.New("HandshakeTimeoutError")
+	FrameTooLargeError       = errors.New("FrameTooLargeError")
+	AddrInvalidError         = errors.New("AddrInvalidError")
+	AddrInUseError           = errors.New("AddrInUseError")
+	AddrNotFoundError        = errors.New("AddrNotFoundError")
+	GoingAwayError           = errors.New("GoingAwayError")
+	ServerClosedError        = errors.New("ServerClosedError")
+	ConnectionLimitError     = errors.New("ConnectionLimitError")
+	IPConnectionLimitError   = errors.New("IPConnectionLimitError")
+	ConnectionRateLimitError = errors.New("ConnectionRateLimitError")
+	SendQueueFullError       = errors.New("SendQueueFullError")
 )
 
 const (
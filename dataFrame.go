@@ -1,6 +1,9 @@
 package rpc
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"time"
+)
 
 // 数据帧
 type DataFrame struct {
@@ -10,8 +13,12 @@ type DataFrame struct {
 	ResponseFrameId uint32 //// 传输帧Id
 	ContentLength   uint32 //// 内容长度
 	MethodNameBytes []byte //// 方法名
-	MethodNameLen   byte   ///// 方法名长度
+	MethodNameLen   uint16 ///// 方法名长度，V1协议头最长255
 	Data            []byte //// 内容具体数据
+
+	Timeout    uint32 //// 请求剩余的超时时长(单位：毫秒)，0表示未设置
+	ExpireTime int64  //// 过期时间点(单位：毫秒)，由接收方根据Timeout计算
+	MethodId   uint32 //// 方法Id，0表示使用方法名，不为0时MethodNameBytes为空
 }
 
 //// 传输类型 0:正常包 1：心跳包
@@ -49,12 +56,131 @@ func (this *DataFrame) SetIsNeedResponse(isNeedResponse bool) {
 	}
 }
 
+// 是否带有扩展字段
+func (this *DataFrame) HasExtend() bool {
+	return this.Flag&0x10 == 0x10
+}
+
+// 内容是否经过压缩
+func (this *DataFrame) IsCompressed() bool {
+	return this.Flag&0x20 == 0x20
+}
+
+// 设置内容是否经过压缩
+func (this *DataFrame) SetCompressed(isCompressed bool) {
+	if isCompressed {
+		this.Flag = this.Flag | 0x20
+	} else {
+		this.Flag = this.Flag &^ 0x20
+	}
+}
+
+// 是否带有校验码
+func (this *DataFrame) HasChecksum() bool {
+	return this.Flag&0x40 == 0x40
+}
+
+// 设置是否带有校验码
+func (this *DataFrame) SetChecksum(isChecksum bool) {
+	if isChecksum {
+		this.Flag = this.Flag | 0x40
+	} else {
+		this.Flag = this.Flag &^ 0x40
+	}
+}
+
+// 设置请求剩余的超时时长
+func (this *DataFrame) SetTimeout(timeout uint32) {
+	this.Timeout = timeout
+}
+
+// 设置方法Id，设置后不再发送方法名
+func (this *DataFrame) SetMethodId(methodId uint32) {
+	this.MethodId = methodId
+	if methodId > 0 {
+		this.MethodNameLen = 0
+	}
+}
+
+// 获取扩展字段数据(包含2字节的长度)，并同步设置Flag中的扩展位
+func (this *DataFrame) buildExtend(order binary.ByteOrder) []byte {
+	var extend []byte
+	if this.Timeout > 0 {
+		value := make([]byte, 4)
+		order.PutUint32(value, this.Timeout)
+		extend = append(extend, ExtendKey_Timeout, byte(len(value)))
+		extend = append(extend, value...)
+	}
+	if this.MethodId > 0 {
+		value := make([]byte, 4)
+		order.PutUint32(value, this.MethodId)
+		extend = append(extend, ExtendKey_MethodId, byte(len(value)))
+		extend = append(extend, value...)
+	}
+
+	if len(extend) == 0 {
+		this.Flag = this.Flag &^ 0x10
+		return nil
+	}
+
+	this.Flag = this.Flag | 0x10
+	result := make([]byte, 2, 2+len(extend))
+	order.PutUint16(result, uint16(len(extend)))
+
+	return append(result, extend...)
+}
+
+// 解析扩展字段(不包含2字节的长度)，不认识的Key会被跳过
+func (this *DataFrame) parseExtend(extend []byte, order binary.ByteOrder) error {
+	for len(extend) > 0 {
+		if len(extend) < 2 || len(extend) < 2+int(extend[1]) {
+			return InnerDataError
+		}
+
+		key, value := extend[0], extend[2:2+int(extend[1])]
+		extend = extend[2+len(value):]
+
+		switch key {
+		case ExtendKey_Timeout:
+			if len(value) != 4 {
+				return InnerDataError
+			}
+
+			this.Timeout = order.Uint32(value)
+			this.ExpireTime = time.Now().UnixNano()/1000000 + int64(this.Timeout)
+		case ExtendKey_MethodId:
+			if len(value) != 4 {
+				return InnerDataError
+			}
+
+			this.MethodId = order.Uint32(value)
+		}
+	}
+
+	return nil
+}
+
 func (this *DataFrame) SetData(data []byte) {
 	this.MethodNameBytes = data[:this.MethodNameLen]
 	this.Data = data[this.MethodNameLen:]
 }
 
+// 获取协议头，方法名长度超过255时使用V2协议头
 func (this *DataFrame) GetHeader(order binary.ByteOrder) []byte {
+	if this.MethodNameLen > getMaxMethodNameLen(HeaderVersion_V1) {
+		header := make([]byte, HEADER_LENGTH_V2)
+
+		header[0] = HEADER_V2
+		header[1] = this.Flag
+		order.PutUint32(header[2:], this.RequestFrameId)
+		order.PutUint32(header[6:], this.ResponseFrameId)
+		order.PutUint32(header[10:], this.ContentLength)
+		order.PutUint16(header[14:], this.MethodNameLen)
+		header[16] = TAIL
+
+		return header
+	}
+
 	header := make([]byte, HEADER_LENGTH)
 
 	header[0] = HEADER
@@ -62,7 +188,7 @@ func (this *DataFrame) GetHeader(order binary.ByteOrder) []byte {
 	order.PutUint32(header[2:], this.RequestFrameId)
 	order.PutUint32(header[6:], this.ResponseFrameId)
 	order.PutUint32(header[10:], this.ContentLength)
-	header[14] = this.MethodNameLen
+	header[14] = byte(this.MethodNameLen)
 	header[15] = TAIL
 
 	return header
@@ -72,6 +198,7 @@ func (this *DataFrame) MethodName() string {
 	return string(this.MethodNameBytes)
 }
 
+// 根据协议头字节判断协议头版本，并解析出帧
 func convertHeader(header []byte, order binary.ByteOrder) *DataFrame {
 	frameData := &DataFrame{}
 
@@ -80,11 +207,36 @@ func convertHeader(header []byte, order binary.ByteOrder) *DataFrame {
 	frameData.ResponseFrameId = order.Uint32(header[6:10])
 
 	frameData.ContentLength = order.Uint32(header[10:14])
-	frameData.MethodNameLen = header[14]
+	if header[0] == HEADER_V2 {
+		frameData.MethodNameLen = order.Uint16(header[14:16])
+	} else {
+		frameData.MethodNameLen = uint16(header[14])
+	}
 
 	return frameData
 }
 
+// 获取协议头字节对应的协议头长度，不是协议头字节则返回0
+func getHeaderLength(headerByte byte) int {
+	switch headerByte {
+	case HEADER:
+		return HEADER_LENGTH
+	case HEADER_V2:
+		return HEADER_LENGTH_V2
+	default:
+		return 0
+	}
+}
+
+// 获取协议头版本支持的最大方法名长度
+func getMaxMethodNameLen(headerVersion byte) uint16 {
+	if headerVersion >= HeaderVersion_V2 {
+		return 0xFFFF
+	}
+
+	return 0xFF
+}
+
 func newRequestFrame(requestObj *RequestInfo, methodName string, data []byte, requestId uint32, isNeedResponse bool) *DataFrame {
 	result := &DataFrame{
 		RequestObj:      requestObj,
@@ -95,7 +247,7 @@ func newRequestFrame(requestObj *RequestInfo, methodName string, data []byte, re
 		Data:            data,
 	}
 
-	result.MethodNameLen = byte(len(result.MethodNameBytes))
+	result.MethodNameLen = uint16(len(result.MethodNameBytes))
 	result.ContentLength = uint32(len(data))
 	result.SetIsNeedResponse(isNeedResponse)
 
@@ -104,7 +256,7 @@ func newRequestFrame(requestObj *RequestInfo, methodName string, data []byte, re
 
 func newResponseFrame(requestFrame *DataFrame, responseBytes []byte, requestFrameId uint32) *DataFrame {
 	result := &DataFrame{
-		Flag:            requestFrame.Flag,
+		Flag:            requestFrame.Flag &^ 0x70, //// 扩展字段、压缩、校验码标识不回传
 		RequestFrameId:  requestFrameId,
 		ResponseFrameId: requestFrame.RequestFrameId,
 		ContentLength:   uint32(len(responseBytes)),
@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReceiveHeader(t *testing.T) {
+	clientCon, serverCon := net.Pipe()
+	defer clientCon.Close()
+	defer serverCon.Close()
+
+	shortFrame := newRequestFrame(nil, "Sample_Tst", nil, 1, false)
+	longFrame := newRequestFrame(nil, strings.Repeat("a", 300), nil, 2, false)
+
+	go func() {
+		// 前面混入无效数据，需要能重新找到协议头
+		clientCon.Write([]byte{0x01, HEADER_V2, 0x02, HEADER, 0x03})
+		clientCon.Write(shortFrame.GetHeader(binary.BigEndian))
+		clientCon.Write(longFrame.GetHeader(binary.BigEndian))
+	}()
+
+	connObj := &RpcConnection{con: serverCon}
+	header := make([]byte, HEADER_LENGTH_V2)
+	for _, expectFrame := range []*DataFrame{shortFrame, longFrame} {
+		if err := connObj.receiveHeader(serverCon, header); err != nil {
+			t.Errorf("receive header error:%v", err)
+			return
+		}
+
+		frameObj := convertHeader(header, binary.BigEndian)
+		if frameObj.RequestFrameId != expectFrame.RequestFrameId || frameObj.MethodNameLen != expectFrame.MethodNameLen {
+			t.Errorf("expect frame:%v-%v but got:%v-%v", expectFrame.RequestFrameId, expectFrame.MethodNameLen, frameObj.RequestFrameId, frameObj.MethodNameLen)
+			return
+		}
+	}
+}
+
+func TestHeaderVersionNegotiate(t *testing.T) {
+	longName := strings.Repeat("a", 300)
+	for _, item := range []struct {
+		clientVersion byte
+		expectVersion byte
+		expectErr     error
+	}{
+		{HeaderVersion_V2, HeaderVersion_V2, nil},
+		{HeaderVersion_V1, HeaderVersion_V1, MethodNameTooLongError},
+	} {
+		apiMgr := newApiMgr()
+		apiMgr.RegisterFunc("Sample", longName, func(connObj RpcConnectioner, value int) int { return value })
+
+		clientCon, serverCon := net.Pipe()
+		serverObj := NewRpcConnection4Server(serverCon, apiMgr, binary.LittleEndian, GetJsonConvertor)
+
+		// 服务端默认支持V2，协商结果取决于客户端
+		clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+		clientObj.SetHeaderVersion(item.clientVersion)
+		if err := clientObj.Start2(clientCon); err != nil {
+			t.Errorf("start error:%v", err)
+			serverObj.Close()
+			return
+		}
+
+		var value int
+		err := clientObj.Call("Sample_"+longName, []interface{}{1}, []interface{}{&value})
+		if err != item.expectErr || (err == nil && value != 1) {
+			t.Errorf("client version:%v call error:%v value:%v", item.clientVersion, err, value)
+		}
+		if headerVersion := serverObj.getNegotiated().headerVersion; headerVersion != item.expectVersion {
+			t.Errorf("client version:%v negotiated version:%v", item.clientVersion, headerVersion)
+		}
+
+		clientObj.Close()
+		serverObj.Close()
+	}
+}
@@ -0,0 +1,110 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// 客户端连接服务端的超时时间
+const dialTimeout = 10 * time.Second
+
+// 连接创建接口，客户端连接和重连时使用，可用于Unix套接字、代理以及测试用的内存连接等
+type Dialer interface {
+	// Dial 连接到指定地址
+	// ctx:超时后需要放弃连接
+	Dial(ctx context.Context, addr string) (net.Conn, error)
+}
+
+// 函数形式的Dialer
+type DialerFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+func (this DialerFunc) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	return this(ctx, addr)
+}
+
+// 默认的Dialer，根据地址格式使用tcp、Unix套接字或内存连接
+type defaultDialer struct {
+	net.Dialer
+}
+
+func (this *defaultDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	network, address, err := parseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if network == AddrScheme_Mem {
+		return dialPipe(ctx, address)
+	}
+
+	return this.DialContext(ctx, network, address)
+}
+
+// 在其他Dialer创建的连接上进行TLS握手
+type tlsDialer struct {
+	dialer Dialer
+	config *tls.Config
+}
+
+func (this *tlsDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	con, err := this.dialer.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	config := this.config
+	if config.ServerName == "" {
+		// 与tls.Dial一致，没有设置ServerName时使用地址中的主机名
+		host := addr
+		if network, address, parseErr := parseAddr(addr); parseErr == nil && network == "tcp" {
+			host = address
+			if tmpHost, _, splitErr := net.SplitHostPort(address); splitErr == nil {
+				host = tmpHost
+			}
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	tlsCon := tls.Client(con, config)
+	if err = tlsCon.HandshakeContext(ctx); err != nil {
+		con.Close()
+		return nil, err
+	}
+
+	return tlsCon, nil
+}
+
+// NewTLSDialer 新建TLS的Dialer，在dialer创建的连接上进行TLS握手
+// dialer:底层连接的创建，为nil则使用tcp
+// config:TLS配置
+func NewTLSDialer(dialer Dialer, config *tls.Config) Dialer {
+	if dialer == nil {
+		dialer = new(defaultDialer)
+	}
+
+	return &tlsDialer{
+		dialer: dialer,
+		config: config,
+	}
+}
+
+// SetDialer 设置连接服务端时使用的Dialer，为nil则使用tcp，需要在Start前设置，重连后依然有效
+// 同时设置了TLS配置时，会在dialer创建的连接上进行TLS握手
+func (this *RpcClient) SetDialer(dialer Dialer) {
+	this.dialer = dialer
+}
+
+// getDialer 获取连接服务端使用的Dialer
+func (this *RpcClient) getDialer() Dialer {
+	var dialer Dialer = new(defaultDialer)
+	if this.dialer != nil {
+		dialer = this.dialer
+	}
+	if this.tlsConfig != nil {
+		dialer = NewTLSDialer(dialer, this.tlsConfig)
+	}
+
+	return dialer
+}
@@ -0,0 +1,214 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDialer(t *testing.T) {
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "rpc.sock"))
+	if err != nil {
+		t.Skipf("unix socket not supported:%v", err)
+	}
+	defer listener.Close()
+
+	serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+	serverObj.RegisterFunc("Sample", "Echo", func(connObj RpcConnectioner, value int) int { return value })
+	go serverObj.Start2(listener)
+
+	var dialCount int32
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	connectedChan := newConnectedChan(clientObj)
+	clientObj.SetDialer(DialerFunc(func(ctx context.Context, addr string) (net.Conn, error) {
+		atomic.AddInt32(&dialCount, 1)
+
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", addr)
+	}))
+	if err = clientObj.Start(listener.Addr().String(), true); err != nil {
+		t.Errorf("start error:%v", err)
+		return
+	}
+	defer clientObj.Close()
+	waitConnectedChan(connectedChan)
+
+	// 断线后使用同一个Dialer重连
+	clientObj.Conn().Close()
+	if waitConnectedChan(connectedChan) == false {
+		t.Errorf("reconnect timeout")
+		return
+	}
+
+	var value int
+	err = clientObj.Call("Sample_Echo", []interface{}{1}, []interface{}{&value})
+	if err != nil || value != 1 || atomic.LoadInt32(&dialCount) < 2 {
+		t.Errorf("call after reconnect error:%v value:%v dialCount:%v", err, value, dialCount)
+	}
+}
+
+// newConnectedChan 创建每次握手成功后都会收到通知的通道
+// 重连会替换客户端的连接对象，测试中需要等到通知后再使用客户端
+func newConnectedChan(clientObj *RpcClient) <-chan struct{} {
+	result := make(chan struct{}, 4)
+	clientObj.AddConnectedHandler("test.connected", func(connObj RpcConnectioner) {
+		select {
+		case result <- struct{}{}:
+		default:
+		}
+	})
+
+	return result
+}
+
+// waitConnectedChan 等待握手成功的通知，超时返回false
+func waitConnectedChan(connectedChan <-chan struct{}) bool {
+	select {
+	case <-connectedChan:
+		return true
+	case <-time.After(2 * time.Second):
+		return false
+	}
+}
+
+func TestCloseDuringReconnect(t *testing.T) {
+	listener := NewPipeListener("")
+	defer listener.Close()
+
+	serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+	go serverObj.Start2(listener)
+
+	// 第一次连接直接成功，重连时阻塞到测试调用Close之后
+	var dialCount int32
+	dialingChan := make(chan struct{})
+	releaseChan := make(chan struct{})
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	clientObj.SetDialer(DialerFunc(func(ctx context.Context, addr string) (net.Conn, error) {
+		if atomic.AddInt32(&dialCount, 1) == 2 {
+			close(dialingChan)
+			<-releaseChan
+		}
+
+		return listener.Dial(ctx, addr)
+	}))
+	var handshakeCount int32
+	clientObj.AddHandshakeResultHandler("test", func(connObj RpcConnectioner, err error) {
+		atomic.AddInt32(&handshakeCount, 1)
+	})
+	if err := clientObj.Start(listener.Addr().String(), true); err != nil {
+		t.Errorf("start error:%v", err)
+		return
+	}
+
+	clientObj.Conn().Close()
+	select {
+	case <-dialingChan:
+	case <-time.After(2 * time.Second):
+		t.Errorf("reconnect timeout")
+		return
+	}
+
+	// 重连的Dial返回前关闭客户端，之后建立的连接不能再被使用
+	clientObj.Close()
+	closedHandshakeCount := atomic.LoadInt32(&handshakeCount)
+	close(releaseChan)
+	time.Sleep(100 * time.Millisecond)
+
+	if count := atomic.LoadInt32(&handshakeCount); count != closedHandshakeCount {
+		t.Errorf("handshake after close, count:%v", count-closedHandshakeCount)
+	}
+	if clientObj.IsClosed() == false {
+		t.Errorf("client reconnected after close")
+	}
+	if count := atomic.LoadInt32(&dialCount); count != 2 {
+		t.Errorf("dial count:%v", count)
+	}
+}
+
+func TestReconnectInterval(t *testing.T) {
+	// 监听已关闭，每次连接都会失败
+	listener := NewPipeListener("")
+	listener.Close()
+
+	var dialCount int32
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	clientObj.SetDialer(DialerFunc(func(ctx context.Context, addr string) (net.Conn, error) {
+		atomic.AddInt32(&dialCount, 1)
+		return listener.Dial(ctx, addr)
+	}))
+	if err := clientObj.Start(listener.Addr().String(), true); err != nil {
+		t.Errorf("start error:%v", err)
+		return
+	}
+
+	// 等待时间从minReconnectInterval开始翻倍
+	time.Sleep(5 * minReconnectInterval)
+	if count := atomic.LoadInt32(&dialCount); count < 2 || count > 4 {
+		t.Errorf("dial count:%v", count)
+	}
+
+	// 关闭后不再重连
+	clientObj.Close()
+	closedDialCount := atomic.LoadInt32(&dialCount)
+	time.Sleep(5 * minReconnectInterval)
+	if count := atomic.LoadInt32(&dialCount); count != closedDialCount {
+		t.Errorf("dial after close count:%v", count-closedDialCount)
+	}
+}
+
+func TestReconnectHandshakeError(t *testing.T) {
+	listener := NewPipeListener("")
+	defer listener.Close()
+
+	serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+	serverObj.SetAdmissionConfig(AdmissionConfig{MaxConnectionCount: 1})
+	go serverObj.Start2(listener)
+
+	newClient := func(byteOrder binary.ByteOrder, dialCount *int32) *RpcClient {
+		clientObj := NewRpcClient(byteOrder, GetJsonConvertor)
+		clientObj.SetDialer(DialerFunc(func(ctx context.Context, addr string) (net.Conn, error) {
+			atomic.AddInt32(dialCount, 1)
+			return listener.Dial(ctx, addr)
+		}))
+
+		return clientObj
+	}
+
+	// 双方不兼容，重连也不会成功，不再重连
+	var dialCount int32
+	clientObj := newClient(binary.BigEndian, &dialCount)
+	err := clientObj.Start(listener.Addr().String(), true)
+	if errors.Is(err, HandshakeError) == false && errors.Is(err, HandshakeRejectedError) == false {
+		t.Errorf("expect handshake error but got:%v", err)
+	}
+	time.Sleep(3 * minReconnectInterval)
+	if count := atomic.LoadInt32(&dialCount); count != 1 {
+		t.Errorf("incompatible dial count:%v", count)
+	}
+	clientObj.Close()
+
+	// 因连接数限制被拒绝时，继续重连直到成功
+	firstObj := newClient(binary.LittleEndian, new(int32))
+	if err = firstObj.Start(listener.Addr().String(), false); err != nil {
+		t.Errorf("start error:%v", err)
+		return
+	}
+
+	dialCount = 0
+	clientObj = newClient(binary.LittleEndian, &dialCount)
+	connectedChan := newConnectedChan(clientObj)
+	if err = clientObj.Start(listener.Addr().String(), true); errors.Is(err, HandshakeRejectedError) == false {
+		t.Errorf("expect handshake rejected error but got:%v", err)
+	}
+	defer clientObj.Close()
+	time.Sleep(2 * minReconnectInterval)
+	firstObj.Close()
+	if waitConnectedChan(connectedChan) == false {
+		t.Errorf("reconnect timeout, dial count:%v", atomic.LoadInt32(&dialCount))
+	}
+}
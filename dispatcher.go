@@ -0,0 +1,198 @@
+package rpc
+
+import "sync"
+
+// 请求分发模式
+type DispatchMode int
+
+const (
+	// 串行处理，每个连接同一时间只处理一个请求(默认)
+	DispatchMode_Serial DispatchMode = iota
+
+	// 每个请求开启一个协程进行处理，不限制数量
+	DispatchMode_Goroutine
+
+	// 使用固定数量的协程进行处理，队列满时返回ServerBusyError
+	DispatchMode_WorkerPool
+)
+
+// 请求分发配置
+type DispatchConfig struct {
+	Mode        DispatchMode
+	WorkerCount int //// 协程池的协程数量，只对DispatchMode_WorkerPool有效
+	QueueSize   int //// 协程池的等待队列长度，只对DispatchMode_WorkerPool有效
+}
+
+// 请求分发器
+type requestDispatcher interface {
+	// dispatch 分发一个请求处理任务，返回false表示已没有处理能力
+	dispatch(taskFunc func()) bool
+
+	// stop 停止分发，已分发的任务会继续执行完
+	stop()
+}
+
+// 串行分发，直接在请求处理协程中执行
+type serialDispatcher struct {
+}
+
+func (this *serialDispatcher) dispatch(taskFunc func()) bool {
+	taskFunc()
+	return true
+}
+
+func (this *serialDispatcher) stop() {
+}
+
+// 每个请求一个协程
+type goroutineDispatcher struct {
+}
+
+func (this *goroutineDispatcher) dispatch(taskFunc func()) bool {
+	go taskFunc()
+	return true
+}
+
+func (this *goroutineDispatcher) stop() {
+}
+
+// 协程池
+type workerPoolDispatcher struct {
+	taskChan  chan func()
+	isStopped bool //// 是否已停止，停止后不再接收任务
+	lockObj   sync.RWMutex
+}
+
+func (this *workerPoolDispatcher) dispatch(taskFunc func()) bool {
+	this.lockObj.RLock()
+	defer this.lockObj.RUnlock()
+
+	// 已停止时taskChan已关闭，按没有处理能力处理
+	if this.isStopped {
+		return false
+	}
+
+	select {
+	case this.taskChan <- taskFunc:
+		return true
+	default:
+		return false
+	}
+}
+
+func (this *workerPoolDispatcher) stop() {
+	this.lockObj.Lock()
+	defer this.lockObj.Unlock()
+
+	if this.isStopped {
+		return
+	}
+
+	this.isStopped = true
+	close(this.taskChan)
+}
+
+func (this *workerPoolDispatcher) work() {
+	for taskFunc := range this.taskChan {
+		taskFunc()
+	}
+}
+
+func newWorkerPoolDispatcher(workerCount int, queueSize int) *workerPoolDispatcher {
+	if workerCount <= 0 {
+		workerCount = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	result := &workerPoolDispatcher{
+		taskChan: make(chan func(), queueSize),
+	}
+
+	for i := 0; i < workerCount; i++ {
+		go result.work()
+	}
+
+	return result
+}
+
+// newRequestDispatcher 根据配置创建请求分发器
+func newRequestDispatcher(config DispatchConfig) requestDispatcher {
+	switch config.Mode {
+	case DispatchMode_Goroutine:
+		return new(goroutineDispatcher)
+	case DispatchMode_WorkerPool:
+		return newWorkerPoolDispatcher(config.WorkerCount, config.QueueSize)
+	default:
+		return new(serialDispatcher)
+	}
+}
+
+// 每个连接等待串行执行的任务数量上限，超过时按没有处理能力处理
+var maxOrderedQueueSize = 1024
+
+// 按Key串行执行的任务队列，不同Key之间可以并发执行
+type orderedQueue struct {
+	data    map[interface{}][]func() //// Key对应的待执行任务，存在Key则表示已有协程在处理
+	count   int                      //// 所有Key的待执行任务数量
+	lockObj sync.Mutex
+}
+
+// dispatch 添加一个任务，如果该Key没有正在处理的协程，则通过dispatcherObj开启处理
+// 待执行的任务数量达到maxOrderedQueueSize时返回false
+func (this *orderedQueue) dispatch(key interface{}, taskFunc func(), dispatcherObj requestDispatcher) bool {
+	this.lockObj.Lock()
+	if this.count >= maxOrderedQueueSize {
+		this.lockObj.Unlock()
+		return false
+	}
+	taskList, exist := this.data[key]
+	this.data[key] = append(taskList, taskFunc)
+	this.count++
+	this.lockObj.Unlock()
+
+	if exist {
+		// 已有协程在处理，排队即可
+		return true
+	}
+
+	isOk := dispatcherObj.dispatch(func() {
+		this.run(key)
+	})
+	if isOk == false {
+		this.lockObj.Lock()
+		this.count -= len(this.data[key])
+		delete(this.data, key)
+		this.lockObj.Unlock()
+	}
+
+	return isOk
+}
+
+// run 依次执行Key对应的所有任务，直到队列为空
+func (this *orderedQueue) run(key interface{}) {
+	for {
+		this.lockObj.Lock()
+		taskList := this.data[key]
+		if len(taskList) == 0 {
+			delete(this.data, key)
+			this.lockObj.Unlock()
+			return
+		}
+
+		taskFunc := taskList[0]
+		taskList[0] = nil
+		this.data[key] = taskList[1:]
+		this.count--
+		this.lockObj.Unlock()
+
+		taskFunc()
+	}
+}
+
+func newOrderedQueue() *orderedQueue {
+	return &orderedQueue{
+		data: make(map[interface{}][]func(), 4),
+	}
+}
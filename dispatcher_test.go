@@ -0,0 +1,294 @@
+package rpc
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolDispatcher(t *testing.T) {
+	dispatcherObj := newWorkerPoolDispatcher(1, 1)
+
+	// 一个协程处理中，一个任务排队，之后的任务没有处理能力
+	startChan := make(chan struct{})
+	waitChan := make(chan struct{})
+	if dispatcherObj.dispatch(func() { close(startChan); <-waitChan }) == false {
+		t.Errorf("dispatch fail")
+		return
+	}
+	<-startChan
+	if dispatcherObj.dispatch(func() {}) == false {
+		t.Errorf("dispatch to queue fail")
+	}
+	if dispatcherObj.dispatch(func() {}) {
+		t.Errorf("dispatch should fail when queue is full")
+	}
+	close(waitChan)
+
+	// 停止后不再接收任务，也不会向已关闭的队列发送
+	dispatcherObj.stop()
+	dispatcherObj.stop()
+	if dispatcherObj.dispatch(func() {}) {
+		t.Errorf("dispatch should fail after stop")
+	}
+}
+
+func TestDispatchBusy(t *testing.T) {
+	startChan := make(chan struct{}, 1)
+	waitChan := make(chan struct{})
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Wait", func(connObj RpcConnectioner) {
+		startChan <- struct{}{}
+		<-waitChan
+	})
+
+	serverObj, clientObj := newTestConnectionPair(t, apiMgr)
+	defer serverObj.Close()
+	defer clientObj.Close()
+	serverObj.SetDispatchConfig(DispatchConfig{Mode: DispatchMode_WorkerPool, WorkerCount: 1})
+
+	downChan, err := clientObj.CallAsync("Sample_Wait", nil, nil)
+	if err != nil {
+		t.Errorf("call error:%v", err)
+		return
+	}
+	<-startChan
+
+	// 唯一的协程处理中，且没有等待队列
+	if err = clientObj.Call("Sample_Wait", nil, nil); errors.Is(err, ServerBusyError) == false {
+		t.Errorf("expect ServerBusyError but got:%v", err)
+	}
+
+	close(waitChan)
+	if err = <-downChan; err != nil {
+		t.Errorf("call error:%v", err)
+	}
+}
+
+func TestDispatchConfigSwitch(t *testing.T) {
+	startChan := make(chan struct{}, 2)
+	waitChan := make(chan struct{})
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Wait", func(connObj RpcConnectioner) {
+		startChan <- struct{}{}
+		<-waitChan
+	})
+	apiMgr.RegisterFunc("Sample", "Echo", func(connObj RpcConnectioner, value int) int { return value })
+
+	serverObj, clientObj := newTestConnectionPair(t, apiMgr)
+	defer serverObj.Close()
+	defer clientObj.Close()
+
+	var value int
+	if err := clientObj.Call("Sample_Echo", []interface{}{1}, []interface{}{&value}); err != nil || value != 1 {
+		t.Errorf("serial call error:%v value:%v", err, value)
+	}
+
+	// 连接处理过程中切换为并发处理，两个请求可以同时执行
+	serverObj.SetDispatchConfig(DispatchConfig{Mode: DispatchMode_Goroutine})
+	downChan1, _ := clientObj.CallAsync("Sample_Wait", nil, nil)
+	downChan2, _ := clientObj.CallAsync("Sample_Wait", nil, nil)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-startChan:
+		case <-time.After(time.Second):
+			t.Errorf("requests not handled in parallel")
+		}
+	}
+	close(waitChan)
+	if err1, err2 := <-downChan1, <-downChan2; err1 != nil || err2 != nil {
+		t.Errorf("parallel call error:%v %v", err1, err2)
+	}
+
+	// 再切换为协程池，旧的分发器被停止后依然可以正常处理
+	serverObj.SetDispatchConfig(DispatchConfig{Mode: DispatchMode_WorkerPool, WorkerCount: 2, QueueSize: 2})
+	if err := clientObj.Call("Sample_Echo", []interface{}{2}, []interface{}{&value}); err != nil || value != 2 {
+		t.Errorf("worker pool call error:%v value:%v", err, value)
+	}
+
+	// 连接关闭后设置的协程池会立即停止
+	serverObj.Close()
+	serverObj.closeWaitGroup.Wait()
+	serverObj.SetDispatchConfig(DispatchConfig{Mode: DispatchMode_WorkerPool, WorkerCount: 1})
+	if serverObj.dispatcher.dispatch(func() {}) {
+		t.Errorf("dispatcher should be stopped after connection closed")
+	}
+}
+
+func TestDispatchConfigSwitchInHandler(t *testing.T) {
+	startChan := make(chan struct{}, 2)
+	waitChan := make(chan struct{})
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Switch", func(connObj RpcConnectioner) {
+		connObj.SetDispatchConfig(DispatchConfig{Mode: DispatchMode_Goroutine})
+	})
+	apiMgr.RegisterFunc("Sample", "Wait", func(connObj RpcConnectioner) {
+		startChan <- struct{}{}
+		<-waitChan
+	})
+
+	serverObj, clientObj := newTestConnectionPair(t, apiMgr)
+	defer serverObj.Close()
+	defer clientObj.Close()
+
+	// 串行分发时处理函数在分发协程中执行，修改分发方式不能死锁
+	if err := clientObj.CallTimeout("Sample_Switch", nil, nil, 1000); err != nil {
+		t.Errorf("switch error:%v", err)
+		return
+	}
+
+	downChan1, _ := clientObj.CallAsync("Sample_Wait", nil, nil)
+	downChan2, _ := clientObj.CallAsync("Sample_Wait", nil, nil)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-startChan:
+		case <-time.After(time.Second):
+			t.Errorf("requests not handled in parallel")
+		}
+	}
+	close(waitChan)
+	if err1, err2 := <-downChan1, <-downChan2; err1 != nil || err2 != nil {
+		t.Errorf("parallel call error:%v %v", err1, err2)
+	}
+}
+
+func TestOrderedKey(t *testing.T) {
+	var lockObj sync.Mutex
+	orderData := make(map[string][]int, 2)
+	startChan := make(chan struct{}, 2)
+	waitChan := make(chan struct{})
+	keyFunc := func(connObj RpcConnectioner, paramList []interface{}) interface{} {
+		switch paramList[0].(string) {
+		case "panic":
+			panic("order key panic")
+		case "slice":
+			return []string{"slice"}
+		}
+
+		return paramList[0]
+	}
+
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Add", func(connObj RpcConnectioner, key string, index int) {
+		if index == 0 {
+			// 第一个请求处理较慢，同一Key的后续请求依然要等它完成
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		lockObj.Lock()
+		orderData[key] = append(orderData[key], index)
+		lockObj.Unlock()
+	}, WithOrderedKey(keyFunc))
+	apiMgr.RegisterFunc("Sample", "Wait", func(connObj RpcConnectioner, key string) {
+		startChan <- struct{}{}
+		<-waitChan
+	}, WithOrderedKey(keyFunc))
+
+	serverObj, clientObj := newTestConnectionPair(t, apiMgr)
+	defer serverObj.Close()
+	defer clientObj.Close()
+	serverObj.SetDispatchConfig(DispatchConfig{Mode: DispatchMode_Goroutine})
+
+	// 相同Key按接收顺序执行
+	downChanList := make([]<-chan error, 0, 6)
+	for i := 0; i < 3; i++ {
+		for _, key := range []string{"a", "b"} {
+			downChan, err := clientObj.CallAsync("Sample_Add", []interface{}{key, i}, nil)
+			if err != nil {
+				t.Errorf("call error:%v", err)
+				return
+			}
+			downChanList = append(downChanList, downChan)
+		}
+	}
+	for _, downChan := range downChanList {
+		if err := <-downChan; err != nil {
+			t.Errorf("call error:%v", err)
+		}
+	}
+	for _, key := range []string{"a", "b"} {
+		if orderList := orderData[key]; len(orderList) != 3 || orderList[0] != 0 || orderList[1] != 1 || orderList[2] != 2 {
+			t.Errorf("key:%v order:%v", key, orderList)
+		}
+	}
+
+	// 不同Key可以同时执行
+	downChan1, _ := clientObj.CallAsync("Sample_Wait", []interface{}{"x"}, nil)
+	downChan2, _ := clientObj.CallAsync("Sample_Wait", []interface{}{"y"}, nil)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-startChan:
+		case <-time.After(time.Second):
+			t.Errorf("different keys not handled in parallel")
+		}
+	}
+	close(waitChan)
+	if err1, err2 := <-downChan1, <-downChan2; err1 != nil || err2 != nil {
+		t.Errorf("parallel call error:%v %v", err1, err2)
+	}
+
+	// Key提取函数异常或Key不可比较时应答错误，连接依然可用
+	if err := clientObj.Call("Sample_Add", []interface{}{"panic", 1}, nil); errors.Is(err, HandlerPanicError) == false {
+		t.Errorf("expect HandlerPanicError but got:%v", err)
+	}
+	if err := clientObj.Call("Sample_Add", []interface{}{"slice", 1}, nil); errors.Is(err, ParamDecodeError) == false {
+		t.Errorf("expect ParamDecodeError but got:%v", err)
+	}
+	if err := clientObj.Call("Sample_Add", []interface{}{"c", 1}, nil); err != nil {
+		t.Errorf("call error:%v", err)
+	}
+}
+
+func TestOrderedQueueLimit(t *testing.T) {
+	oldSize := maxOrderedQueueSize
+	maxOrderedQueueSize = 2
+	defer func() { maxOrderedQueueSize = oldSize }()
+
+	startChan := make(chan struct{}, 1)
+	waitChan := make(chan struct{})
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Wait", func(connObj RpcConnectioner, key string) {
+		if key == "wait" {
+			select {
+			case startChan <- struct{}{}:
+			default:
+			}
+			<-waitChan
+		}
+	}, WithOrderedKey(func(connObj RpcConnectioner, paramList []interface{}) interface{} {
+		return paramList[0]
+	}))
+
+	serverObj, clientObj := newTestConnectionPair(t, apiMgr)
+	defer serverObj.Close()
+	defer clientObj.Close()
+	serverObj.SetDispatchConfig(DispatchConfig{Mode: DispatchMode_Goroutine})
+
+	// 处理中的请求已出队，之后同一Key的请求排队
+	downChanList := make([]<-chan error, 0, 3)
+	downChan, _ := clientObj.CallAsync("Sample_Wait", []interface{}{"wait"}, nil)
+	downChanList = append(downChanList, downChan)
+	<-startChan
+	for i := 0; i < 2; i++ {
+		downChan, _ = clientObj.CallAsync("Sample_Wait", []interface{}{"wait"}, nil)
+		downChanList = append(downChanList, downChan)
+	}
+
+	// 排队数量达到上限，不同Key的请求也没有处理能力
+	if err := clientObj.Call("Sample_Wait", []interface{}{"other"}, nil); errors.Is(err, ServerBusyError) == false {
+		t.Errorf("expect ServerBusyError but got:%v", err)
+	}
+
+	close(waitChan)
+	for _, downChan := range downChanList {
+		if err := <-downChan; err != nil {
+			t.Errorf("call error:%v", err)
+		}
+	}
+
+	// 队列处理完后可以继续添加
+	if err := clientObj.Call("Sample_Wait", []interface{}{"other"}, nil); err != nil {
+		t.Errorf("call error:%v", err)
+	}
+}
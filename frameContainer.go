@@ -17,32 +17,88 @@ type RequestInfo struct {
 
 	// 过期时间点(单位：毫秒)
 	ExpireTime int64
+
+	// 请求完成时关闭，用于通知等待方
+	doneChan chan struct{}
+
+	watchLockObj   sync.Mutex
+	stopWatchFunc  func() bool //// 停止超时或上下文监控的函数，请求完成时调用
+	isWatchStopped bool        //// 请求是否已完成，完成后再设置的监控会立即停止
+}
+
+// claim 抢占应答权，成功后才能写入应答内容，写入后需要调用finish通知等待方
+// 抢占失败说明请求已完成、超时或被取消，此时不能再修改请求的任何字段
+func (this *RequestInfo) claim() bool {
+	return atomic.CompareAndSwapInt32(&this.IsResponsed, No, Yes)
+}
+
+// finish 写入应答结果并通知等待方，只能在claim成功后调用
+func (this *RequestInfo) finish(returnBytes []byte, err error) {
+	this.ReturnBytes = returnBytes
+	this.ErrObj = err
+	this.DownChan <- err
+	close(this.doneChan)
+
+	this.stopWatch()
 }
 
 func (this *RequestInfo) Return(returnObj []interface{}, returnBytes []byte, err error) bool {
-	if atomic.CompareAndSwapInt32(&this.IsResponsed, No, Yes) == false {
+	if this.claim() == false {
 		return false
 	}
 
 	this.ReturnObj = returnObj
-	this.ReturnBytes = returnBytes
-	this.ErrObj = err
-	this.DownChan <- err
+	this.finish(returnBytes, err)
 
 	return true
 }
 
 func (this *RequestInfo) ReturnError(err error) bool {
-	if atomic.CompareAndSwapInt32(&this.IsResponsed, No, Yes) == false {
+	if this.claim() == false {
 		return false
 	}
 
-	this.ErrObj = err
-	this.DownChan <- err
+	this.finish(nil, err)
 
 	return true
 }
 
+// setStopWatchFunc 设置停止监控的函数，请求已完成时立即调用
+func (this *RequestInfo) setStopWatchFunc(stopWatchFunc func() bool) {
+	this.watchLockObj.Lock()
+	if this.isWatchStopped == false {
+		this.stopWatchFunc = stopWatchFunc
+		this.watchLockObj.Unlock()
+		return
+	}
+	this.watchLockObj.Unlock()
+
+	stopWatchFunc()
+}
+
+// stopWatch 请求完成后停止监控，释放定时器或上下文的回调
+func (this *RequestInfo) stopWatch() {
+	this.watchLockObj.Lock()
+	stopWatchFunc := this.stopWatchFunc
+	this.stopWatchFunc = nil
+	this.isWatchStopped = true
+	this.watchLockObj.Unlock()
+
+	if stopWatchFunc != nil {
+		stopWatchFunc()
+	}
+}
+
+func newRequestInfo(requestId uint32, returnObj []interface{}, expireTime int64) *RequestInfo {
+	return &RequestInfo{
+		RequestId:  requestId,
+		DownChan:   make(chan error, 10),
+		ReturnObj:  returnObj,
+		ExpireTime: expireTime,
+		doneChan:   make(chan struct{}),
+	}
+}
+
 type FrameContainer struct {
 	data         map[uint32]*RequestInfo
 	preCheckTime int64
@@ -52,10 +108,13 @@ type FrameContainer struct {
 
 // 获取并删除项
 func (this *FrameContainer) GetRequestInfo(frameId uint32) (result *RequestInfo, exist bool) {
-	this.lockObj.RLock()
-	defer this.lockObj.RUnlock()
+	this.lockObj.Lock()
+	defer this.lockObj.Unlock()
 
 	result, exist = this.data[frameId]
+	if exist {
+		delete(this.data, frameId)
+	}
 
 	return result, exist
 }
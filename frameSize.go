@@ -0,0 +1,108 @@
+package rpc
+
+import (
+	"io"
+
+	"github.com/polariseye/rpc-go/log"
+)
+
+// 默认能接收的最大帧长度(方法名+内容)
+const DefaultMaxFrameSize uint32 = 16 * 1024 * 1024
+
+// 握手帧的最大长度，不受SetMaxFrameSize影响
+const maxHelloFrameSize = 64 * 1024
+
+// 收到超长帧时的处理方式
+type FrameSizeAction int
+
+const (
+	// 关闭连接(默认)
+	FrameSizeAction_Close FrameSizeAction = iota
+
+	// 丢弃帧内容，请求帧应答FrameTooLargeError，应答帧则让对应的请求返回FrameTooLargeError
+	// 心跳和握手帧超长时依然会关闭连接
+	FrameSizeAction_Reject
+)
+
+// getFrameSize 获取帧长度(方法名+内容)
+func getFrameSize(frameObj *DataFrame) uint64 {
+	return uint64(frameObj.ContentLength) + uint64(frameObj.MethodNameLen)
+}
+
+// SetMaxFrameSize 设置能接收的最大帧长度(方法名+内容)，握手时会告知对方，需要在握手前设置
+// maxFrameSize:最大帧长度，0表示不限制
+// action:收到超长帧时的处理方式
+func (this *RpcConnection) SetMaxFrameSize(maxFrameSize uint32, action FrameSizeAction) {
+	if this == nil {
+		return
+	}
+
+	this.maxFrameSize = maxFrameSize
+	this.frameSizeAction = action
+}
+
+// isFrameTooLarge 收到的帧是否超过了最大长度，握手帧固定使用maxHelloFrameSize
+func (this *RpcConnection) isFrameTooLarge(frameObj *DataFrame) bool {
+	if frameObj.TransformType() == TransformType_Hello {
+		return getFrameSize(frameObj) > maxHelloFrameSize
+	}
+
+	return this.maxFrameSize > 0 && getFrameSize(frameObj) > uint64(this.maxFrameSize)
+}
+
+// handleOversizeFrame 处理超长帧，此时只读取了协议头和扩展字段，返回error则关闭连接
+func (this *RpcConnection) handleOversizeFrame(frameObj *DataFrame) error {
+	log.Warn("receive oversize frame ip:%v frameSize:%v maxFrameSize:%v", this.Addr(), getFrameSize(frameObj), this.maxFrameSize)
+	this.rpcWatcherObj.afterOversizeFrame(frameObj)
+
+	if this.frameSizeAction == FrameSizeAction_Close || frameObj.TransformType() != TransformType_Nomal {
+		return FrameTooLargeError
+	}
+
+	// 丢弃帧内容，以便继续解析后面的帧
+	discardSize := int64(getFrameSize(frameObj))
+	if frameObj.HasChecksum() {
+		discardSize += CHECKSUM_LENGTH
+	}
+	if _, err := io.CopyN(io.Discard, this.con, discardSize); err != nil {
+		return err
+	}
+
+	if frameObj.ResponseFrameId != 0 {
+		if requestObj, exist := this.frameContainer.GetRequestInfo(frameObj.ResponseFrameId); exist {
+			requestObj.ReturnError(FrameTooLargeError)
+		}
+
+		return nil
+	}
+
+	// 方法名没有读取，应答中也不带方法名
+	frameObj.MethodNameLen = 0
+	this.response(frameObj, nil, FrameTooLargeError)
+	return nil
+}
+
+// checkSendFrameSize 检查帧长度是否超过对方能接收的最大长度，返回false则不发送
+// 超长的请求直接返回FrameTooLargeError，超长的应答改为错误应答
+func (this *RpcConnection) checkSendFrameSize(frameObj *DataFrame) bool {
+	peerHello := this.getNegotiated().peerHello
+	if peerHello == nil || peerHello.MaxFrameSize == 0 || getFrameSize(frameObj) <= uint64(peerHello.MaxFrameSize) {
+		return true
+	}
+
+	log.Warn("send oversize frame ip:%v frameSize:%v peerMaxFrameSize:%v", this.Addr(), getFrameSize(frameObj), peerHello.MaxFrameSize)
+	if frameObj.RequestObj != nil {
+		this.frameContainer.RemoveRequestObj(frameObj.RequestObj.RequestId)
+		frameObj.RequestObj.ReturnError(FrameTooLargeError)
+
+		return false
+	}
+
+	if frameObj.ResponseFrameId != 0 && frameObj.IsError() == false {
+		frameObj.SetError(string(marshalError(FrameTooLargeError, this.errorDetailLevel)))
+
+		return getFrameSize(frameObj) <= uint64(peerHello.MaxFrameSize)
+	}
+
+	return false
+}
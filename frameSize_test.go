@@ -0,0 +1,113 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sendRawRequest 不经过发送队列直接发送请求，用于模拟不检查帧长度的对方
+func sendRawRequest(connObj *RpcConnection, methodName string, value string) error {
+	requestBytes, err := connObj.getConvertorFunc().MarshalValue(value)
+	if err != nil {
+		return err
+	}
+
+	requestInfoObj := newRequestInfo(connObj.getRequestId(), nil, connObj.getExpireTime(1000))
+	connObj.frameContainer.AddRequest(requestInfoObj)
+	if err = connObj.directlySendFrame(newRequestFrame(requestInfoObj, methodName, requestBytes, requestInfoObj.RequestId, true)); err != nil {
+		return err
+	}
+
+	return <-requestInfoObj.DownChan
+}
+
+func TestMaxFrameSize(t *testing.T) {
+	for _, action := range []FrameSizeAction{FrameSizeAction_Reject, FrameSizeAction_Close} {
+		apiMgr := newApiMgr()
+		apiMgr.RegisterFunc("Sample", "Echo", func(connObj RpcConnectioner, value string) string { return value })
+
+		clientCon, serverCon := net.Pipe()
+		serverObj := newRpcConnection4Server(serverCon, apiMgr, binary.LittleEndian, GetJsonConvertor)
+		serverObj.SetMaxFrameSize(64, action)
+		var oversizeCount int32
+		serverObj.AddOversizeFrameHandler("test", func(connObj RpcConnectioner, frameObj *DataFrame) {
+			atomic.AddInt32(&oversizeCount, 1)
+		})
+		serverObj.start()
+
+		clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+		if err := clientObj.Start2(clientCon); err != nil {
+			t.Errorf("start error:%v", err)
+			serverObj.Close()
+			return
+		}
+
+		// 发送前会检查对方能接收的最大帧长度
+		var value string
+		bigValue := strings.Repeat("a", 100)
+		if err := clientObj.Call("Sample_Echo", []interface{}{bigValue}, []interface{}{&value}); err != FrameTooLargeError {
+			t.Errorf("action:%v expect local FrameTooLargeError but got:%v", action, err)
+		}
+
+		// 绕过发送检查，由接收方处理
+		err := sendRawRequest(clientObj.RpcConnection, "Sample_Echo", bigValue)
+		switch action {
+		case FrameSizeAction_Reject:
+			if errors.Is(err, FrameTooLargeError) == false {
+				t.Errorf("expect remote FrameTooLargeError but got:%v", err)
+			}
+
+			// 丢弃超长帧后，连接依然可用
+			if err = clientObj.Call("Sample_Echo", []interface{}{"a"}, []interface{}{&value}); err != nil || value != "a" {
+				t.Errorf("call after reject error:%v value:%v", err, value)
+			}
+		case FrameSizeAction_Close:
+			if err == nil {
+				t.Errorf("expect connection closed")
+			}
+			for i := 0; i < 100 && serverObj.IsClosed() == false; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if serverObj.IsClosed() == false {
+				t.Errorf("server connection should be closed")
+			}
+		}
+		if count := atomic.LoadInt32(&oversizeCount); count != 1 {
+			t.Errorf("action:%v oversize handler count:%v", action, count)
+		}
+
+		clientObj.Close()
+		serverObj.Close()
+	}
+}
+
+func TestMaxFrameSizeResponse(t *testing.T) {
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Repeat", func(connObj RpcConnectioner, count int) string { return strings.Repeat("a", count) })
+
+	clientCon, serverCon := net.Pipe()
+	serverObj := NewRpcConnection4Server(serverCon, apiMgr, binary.LittleEndian, GetJsonConvertor)
+	defer serverObj.Close()
+
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	clientObj.SetMaxFrameSize(64, FrameSizeAction_Close)
+	if err := clientObj.Start2(clientCon); err != nil {
+		t.Errorf("start error:%v", err)
+		return
+	}
+	defer clientObj.Close()
+
+	// 超过对方最大帧长度的应答改为错误应答
+	var value string
+	if err := clientObj.Call("Sample_Repeat", []interface{}{100}, []interface{}{&value}); errors.Is(err, FrameTooLargeError) == false {
+		t.Errorf("expect FrameTooLargeError but got:%v", err)
+	}
+	if err := clientObj.Call("Sample_Repeat", []interface{}{10}, []interface{}{&value}); err != nil || len(value) != 10 {
+		t.Errorf("call error:%v value:%v", err, value)
+	}
+}
@@ -0,0 +1,350 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// 握手超时时间，超时后关闭连接
+const handshakeTimeout = 10 * time.Second
+
+// 握手状态，两者都完成才算握手成功
+const (
+	// 对方已接受本方的握手信息
+	handshakeState_PeerAccepted = 0x01
+
+	// 本方已接受对方的握手信息，并已应答
+	handshakeState_LocalAccepted = 0x02
+)
+
+// 握手信息，连接建立后双方首先发送握手帧交换此信息，不兼容时拒绝连接
+type HelloInfo struct {
+	Version       int      //// 协议版本
+	ByteOrder     string   //// 字节序
+	Convertor     string   //// 转换器名称
+	Compression   []string `json:",omitempty"` //// 支持的压缩算法，为空表示不支持压缩
+	MaxFrameSize  uint32   //// 能接收的最大帧长度，0表示不限制
+	HeaderVersion byte     //// 能接收的最高协议头版本
+	Checksum      bool     //// 是否需要校验码
+	Timeout       bool     //// 是否能识别请求超时扩展字段，不能识别时不发送
+	MethodList    []string `json:",omitempty"` //// 能识别的方法名，对方只对其中的方法使用方法Id发送请求
+	Error         string   `json:",omitempty"` //// 拒绝握手的原因，只在应答中使用
+}
+
+// 可以提供名称的转换器，握手时用于判断双方的转换器是否一致
+// 没有实现此接口的转换器使用类型名称
+type INamedConvertor interface {
+	Name() string
+}
+
+// getConvertorName 获取转换器名称
+func getConvertorName(convertorObj IByteConvertor) string {
+	if namedObj, ok := convertorObj.(INamedConvertor); ok {
+		return namedObj.Name()
+	}
+
+	return reflect.TypeOf(convertorObj).String()
+}
+
+// 握手后确定的连接参数，在握手完成前发布，之后不再修改，可以在任意协程中读取
+type negotiatedInfo struct {
+	peerHello         *HelloInfo        //// 对方的握手信息
+	headerVersion     byte              //// 发送时可以使用的协议头版本，不超过双方支持的最高版本
+	isUseChecksum     bool              //// 发送时是否带校验码
+	isUseTimeout      bool              //// 发送请求时是否带超时扩展字段
+	peerMethodIdData  map[uint32]string //// 对方能识别的方法Id，value:方法名
+	sendCompressor    ICompressor       //// 发送时使用的压缩算法，为nil则不压缩
+	receiveCompressor ICompressor       //// 对方发送时使用的压缩算法
+}
+
+// 握手完成前使用的连接参数
+var defaultNegotiatedInfo = &negotiatedInfo{
+	headerVersion: HeaderVersion_V1,
+}
+
+// 待发送的握手应答
+type helloResponse struct {
+	frameObj *DataFrame
+	err      error //// 不为nil表示拒绝了对方
+}
+
+// PeerHello 获取对方的握手信息，握手成功前返回nil
+func (this *RpcConnection) PeerHello() *HelloInfo {
+	if negotiatedObj := this.negotiated.Load(); negotiatedObj != nil {
+		return negotiatedObj.peerHello
+	}
+
+	return nil
+}
+
+// getNegotiated 获取握手后确定的连接参数，握手完成前返回defaultNegotiatedInfo
+func (this *RpcConnection) getNegotiated() *negotiatedInfo {
+	if negotiatedObj := this.negotiated.Load(); negotiatedObj != nil {
+		return negotiatedObj
+	}
+
+	return defaultNegotiatedInfo
+}
+
+// getLocalHello 获取本方的握手信息
+func (this *RpcConnection) getLocalHello() *HelloInfo {
+	this.handshakeLockObj.Lock()
+	headerVersion := this.headerVersion
+	this.handshakeLockObj.Unlock()
+
+	return &HelloInfo{
+		Version:       ProtocolVersion,
+		ByteOrder:     this.byteOrder.String(),
+		Convertor:     getConvertorName(this.getConvertorFunc()),
+		Compression:   this.compressionConfig.getCompressorNameList(),
+		MaxFrameSize:  this.maxFrameSize,
+		HeaderVersion: headerVersion,
+		Checksum:      this.isChecksum,
+		Timeout:       true,
+		MethodList:    this.apiMgr.getMethodNameList(),
+	}
+}
+
+// newHelloFrame 创建握手帧
+// requestFrame:对方的握手帧，为nil则创建握手请求，否则创建握手应答
+// errMsg:拒绝握手的原因
+func (this *RpcConnection) newHelloFrame(requestFrame *DataFrame, errMsg string) (*DataFrame, error) {
+	helloObj := this.getLocalHello()
+	helloObj.Error = errMsg
+
+	bytesData, err := json.Marshal(helloObj)
+	if err != nil {
+		return nil, err
+	}
+
+	var frameObj *DataFrame
+	if requestFrame == nil {
+		frameObj = newRequestFrame(nil, "", bytesData, this.getRequestId(), true)
+	} else {
+		frameObj = newResponseFrame(requestFrame, bytesData, this.getRequestId())
+	}
+	frameObj.SetTransformType(TransformType_Hello)
+
+	return frameObj, nil
+}
+
+// getHeaderByteOrder 获取协议头使用的字节序，握手帧固定使用大端，以便双方字节序不一致时也能解析
+func (this *RpcConnection) getHeaderByteOrder(flag byte) binary.ByteOrder {
+	if flag&0x03 == TransformType_Hello {
+		return binary.BigEndian
+	}
+
+	return this.byteOrder
+}
+
+// handshake 发送握手帧，并等待握手完成，在发送协程中调用，握手完成前不会发送其他帧
+func (this *RpcConnection) handshake() error {
+	frameObj, err := this.newHelloFrame(nil, "")
+	if err != nil {
+		return err
+	}
+	if err = this.directlySendFrame(frameObj); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(handshakeTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case item := <-this.helloChan:
+			err = this.directlySendFrame(item.frameObj)
+
+			// 拒绝对方时，对方可能已经关闭了连接，发送失败也以拒绝的原因结束握手
+			if item.err != nil {
+				this.finishHandshake(item.err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			// 应答发送后才能确定对方已知晓结果
+			this.setHandshakeState(handshakeState_LocalAccepted)
+		case <-this.handshakeChan:
+			return this.handshakeErr
+		case <-timer.C:
+			this.finishHandshake(HandshakeTimeoutError)
+		}
+	}
+}
+
+// handleHello 处理对方发来的握手帧，在接收协程中调用
+func (this *RpcConnection) handleHello(frameObj *DataFrame) {
+	select {
+	case <-this.handshakeChan:
+		// 已完成握手，忽略重复的握手帧
+		return
+	default:
+	}
+
+	helloObj := new(HelloInfo)
+	err := json.Unmarshal(frameObj.Data, helloObj)
+	if err != nil {
+		err = fmt.Errorf("%w:invalid hello:%v", HandshakeError, err)
+	}
+
+	if frameObj.ResponseFrameId != 0 {
+		// 对方对本方握手信息的应答
+		if err == nil && helloObj.Error != "" {
+			err = fmt.Errorf("%w:%s", HandshakeRejectedError, helloObj.Error)
+		}
+		if err != nil {
+			this.finishHandshake(err)
+			return
+		}
+
+		this.setHandshakeState(handshakeState_PeerAccepted)
+		return
+	}
+
+	// 对方的握手信息
+	if err == nil {
+		err = this.checkHello(helloObj)
+	}
+
+	errMsg := ""
+	if err != nil {
+		errMsg = err.Error()
+
+		this.handshakeLockObj.Lock()
+		this.rejectErr = err
+		this.handshakeLockObj.Unlock()
+	} else {
+		this.handshakeLockObj.Lock()
+		this.peerHello = helloObj
+		this.handshakeLockObj.Unlock()
+	}
+
+	responseFrame, tmpErr := this.newHelloFrame(frameObj, errMsg)
+	if tmpErr != nil {
+		this.finishHandshake(tmpErr)
+		return
+	}
+
+	select {
+	case this.helloChan <- &helloResponse{frameObj: responseFrame, err: err}:
+	case <-this.handshakeChan:
+	}
+}
+
+// checkHello 检查对方是否与本方兼容
+func (this *RpcConnection) checkHello(peerHello *HelloInfo) error {
+	localHello := this.getLocalHello()
+	if peerHello.Version != localHello.Version {
+		return fmt.Errorf("%w:protocol version not match local:%v peer:%v", HandshakeError, localHello.Version, peerHello.Version)
+	}
+	if peerHello.ByteOrder != localHello.ByteOrder {
+		return fmt.Errorf("%w:byte order not match local:%v peer:%v", HandshakeError, localHello.ByteOrder, peerHello.ByteOrder)
+	}
+	if peerHello.Convertor != localHello.Convertor {
+		return fmt.Errorf("%w:convertor not match local:%v peer:%v", HandshakeError, localHello.Convertor, peerHello.Convertor)
+	}
+
+	// 自定义检查
+	if err := this.rpcWatcherObj.checkHandshake(peerHello); err != nil {
+		return fmt.Errorf("%w:%v", HandshakeError, err)
+	}
+
+	return nil
+}
+
+// isHandshakeRetryable 握手失败后重连是否可能成功
+// 双方不兼容或对方拒绝时重连也不会成功，因连接数限制被拒绝时可以稍后重试
+func isHandshakeRetryable(err error) bool {
+	if errors.Is(err, HandshakeRejectedError) {
+		// 拒绝原因经过网络传输，只能按内容判断
+		for _, retryableErr := range []error{ConnectionLimitError, IPConnectionLimitError, ConnectionRateLimitError} {
+			if strings.Contains(err.Error(), retryableErr.Error()) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return errors.Is(err, HandshakeError) == false
+}
+
+// setHandshakeState 设置握手状态，双方都接受后握手成功
+func (this *RpcConnection) setHandshakeState(state int) {
+	this.handshakeLockObj.Lock()
+	this.handshakeState |= state
+	isDone := this.handshakeState == handshakeState_PeerAccepted|handshakeState_LocalAccepted
+	this.handshakeLockObj.Unlock()
+
+	if isDone {
+		this.finishHandshake(nil)
+	}
+}
+
+// finishHandshake 结束握手，只有第一次调用有效
+// err:握手失败的原因，为nil表示握手成功
+func (this *RpcConnection) finishHandshake(err error) {
+	this.handshakeOnce.Do(func() {
+		// 已拒绝对方时，对方可能先断开连接，此时以拒绝的原因结束握手
+		if err != nil {
+			this.handshakeLockObj.Lock()
+			if this.rejectErr != nil {
+				err = this.rejectErr
+			}
+			this.handshakeLockObj.Unlock()
+		}
+
+		this.handshakeErr = err
+		if err == nil {
+			// 先发布协商结果，再通知握手完成
+			this.negotiated.Store(this.negotiate())
+		}
+
+		close(this.handshakeChan)
+	})
+}
+
+// negotiate 根据双方的握手信息确定连接参数
+func (this *RpcConnection) negotiate() *negotiatedInfo {
+	this.handshakeLockObj.Lock()
+	peerHello := this.peerHello
+	headerVersion := this.headerVersion
+	this.handshakeLockObj.Unlock()
+
+	result := &negotiatedInfo{
+		peerHello:     peerHello,
+		headerVersion: headerVersion,
+		// 任意一方需要校验码，则双方都发送校验码
+		isUseChecksum: this.isChecksum || peerHello.Checksum,
+		isUseTimeout:  peerHello.Timeout,
+	}
+	if peerHello.HeaderVersion < result.headerVersion {
+		// 不能超过对方支持的协议头版本，没有告知版本的对方只支持V1
+		result.headerVersion = peerHello.HeaderVersion
+		if result.headerVersion < HeaderVersion_V1 {
+			result.headerVersion = HeaderVersion_V1
+		}
+	}
+	result.sendCompressor, result.receiveCompressor = negotiateCompressor(this.compressionConfig.CompressorList, peerHello.Compression)
+	if len(peerHello.MethodList) > 0 {
+		result.peerMethodIdData = make(map[uint32]string, len(peerHello.MethodList))
+		for _, methodName := range peerHello.MethodList {
+			result.peerMethodIdData[getMethodId(methodName)] = methodName
+		}
+	}
+
+	return result
+}
+
+// waitHandshake 等待握手完成，返回握手失败的原因
+func (this *RpcConnection) waitHandshake() error {
+	<-this.handshakeChan
+
+	return this.handshakeErr
+}
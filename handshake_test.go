@@ -0,0 +1,137 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandshake(t *testing.T) {
+	// 字节序不一致时双方都会拒绝
+	clientCon, serverCon := net.Pipe()
+	serverObj := NewRpcConnection4Server(serverCon, newApiMgr(), binary.LittleEndian, GetJsonConvertor)
+	defer serverObj.Close()
+
+	clientObj := NewRpcClient(binary.BigEndian, GetJsonConvertor)
+	err := clientObj.Start2(clientCon)
+	if errors.Is(err, HandshakeError) == false && errors.Is(err, HandshakeRejectedError) == false {
+		t.Errorf("expect handshake error but got:%v", err)
+		return
+	}
+	clientObj.Close()
+
+	// 一致时可以正常调用
+	clientCon, serverCon = net.Pipe()
+	serverObj = NewRpcConnection4Server(serverCon, newApiMgr(), binary.LittleEndian, GetJsonConvertor)
+	defer serverObj.Close()
+
+	clientObj = NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	defer clientObj.Close()
+	if err = clientObj.Start2(clientCon); err != nil {
+		t.Errorf("handshake error:%v", err)
+		return
+	}
+
+	if clientObj.PeerHello().Convertor != "json" {
+		t.Errorf("peer hello not match:%+v", clientObj.PeerHello())
+	}
+}
+
+func TestHandshakeResultHandler(t *testing.T) {
+	var resultErr error
+	var isConnected bool
+
+	// 握手失败时只触发握手结果事件
+	clientCon, serverCon := net.Pipe()
+	serverObj := NewRpcConnection4Server(serverCon, newApiMgr(), binary.LittleEndian, GetJsonConvertor)
+	defer serverObj.Close()
+
+	clientObj := NewRpcClient(binary.BigEndian, GetJsonConvertor)
+	clientObj.AddHandshakeResultHandler("test", func(connObj RpcConnectioner, err error) {
+		resultErr = err
+	})
+	clientObj.AddConnectedHandler("test", func(connObj RpcConnectioner) {
+		isConnected = true
+	})
+	if err := clientObj.Start2(clientCon); err == nil || resultErr != err || isConnected {
+		t.Errorf("handshake result not match err:%v resultErr:%v isConnected:%v", err, resultErr, isConnected)
+	}
+	clientObj.Close()
+
+	// 握手成功时两个事件都会触发
+	clientCon, serverCon = net.Pipe()
+	serverObj = NewRpcConnection4Server(serverCon, newApiMgr(), binary.LittleEndian, GetJsonConvertor)
+	defer serverObj.Close()
+
+	clientObj = NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	clientObj.AddHandshakeResultHandler("test", func(connObj RpcConnectioner, err error) {
+		resultErr = err
+	})
+	clientObj.AddConnectedHandler("test", func(connObj RpcConnectioner) {
+		isConnected = true
+	})
+	defer clientObj.Close()
+	if err := clientObj.Start2(clientCon); err != nil || resultErr != nil || isConnected == false {
+		t.Errorf("handshake result not match err:%v resultErr:%v isConnected:%v", err, resultErr, isConnected)
+	}
+}
+
+func TestServerHandshakeResultHandler(t *testing.T) {
+	listener := NewPipeListener("")
+	defer listener.Close()
+
+	serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+	resultChan := make(chan error, 4)
+	serverObj.AddHandshakeResultHandler("test", func(connObj RpcConnectioner, err error) {
+		resultChan <- err
+	})
+	var newConnectionCount int32
+	newConnectionChan := make(chan struct{}, 4)
+	serverObj.AddNewConnectionHandler("test", func(connObj RpcConnectioner) error {
+		atomic.AddInt32(&newConnectionCount, 1)
+		newConnectionChan <- struct{}{}
+		return nil
+	})
+	go serverObj.Start2(listener)
+
+	waitResult := func() (error, bool) {
+		select {
+		case err := <-resultChan:
+			return err, true
+		case <-time.After(2 * time.Second):
+			return nil, false
+		}
+	}
+
+	// 握手失败时只触发握手结果事件，对方先检查出不一致时可能直接断开，所以不检查失败原因
+	for _, byteOrder := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		con, err := listener.Dial(context.Background(), "")
+		if err != nil {
+			t.Errorf("dial error:%v", err)
+			return
+		}
+
+		clientObj := NewRpcClient(byteOrder, GetJsonConvertor)
+		clientObj.Start2(con)
+		err, isOk := waitResult()
+		if isOk == false {
+			t.Errorf("byteOrder:%v handshake result timeout", byteOrder)
+		} else if (byteOrder == binary.LittleEndian) != (err == nil) {
+			t.Errorf("byteOrder:%v handshake result error:%v", byteOrder, err)
+		}
+		clientObj.Close()
+	}
+
+	// 握手结果事件之后才会触发新连接事件
+	select {
+	case <-newConnectionChan:
+	case <-time.After(2 * time.Second):
+	}
+	if count := atomic.LoadInt32(&newConnectionCount); count != 1 {
+		t.Errorf("new connection count:%v", count)
+	}
+}
@@ -8,6 +8,10 @@ import (
 type JsonConvertor struct {
 }
 
+func (this *JsonConvertor) Name() string {
+	return "json"
+}
+
 func (this *JsonConvertor) MarshalValue(valList ...interface{}) ([]byte, error) {
 	bytesData, err := json.Marshal(valList)
 
@@ -25,18 +29,25 @@ func (this *JsonConvertor) MarshalType(typeList []reflect.Type, valList ...refle
 }
 
 func (this *JsonConvertor) UnMarhsalType(bytesData []byte, typeList ...reflect.Type) ([]reflect.Value, error) {
-	data := make([]interface{}, 0, len(typeList))
+	// 先拆分出每个参数的数据，以便知道是哪个参数出错
+	var data []json.RawMessage
+	if err := json.Unmarshal(bytesData, &data); err != nil {
+		return nil, &ParamError{Index: -1, Err: err}
+	}
+
 	result := make([]reflect.Value, 0, len(typeList))
-	for _, item := range typeList {
+	for index, item := range typeList {
 		valItem := reflect.New(item)
-		data = append(data, valItem.Interface())
-		valItem = reflect.Indirect(valItem)
-		result = append(result, valItem)
-	}
+		if index < len(data) {
+			if err := json.Unmarshal(data[index], valItem.Interface()); err != nil {
+				return nil, &ParamError{Index: index, Type: item, Err: err}
+			}
+		}
 
-	err := json.Unmarshal(bytesData, &data)
+		result = append(result, reflect.Indirect(valItem))
+	}
 
-	return result, err
+	return result, nil
 }
 
 func (this *JsonConvertor) UnMarhsalValue(bytesData []byte, valList ...interface{}) error {
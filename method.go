@@ -1,26 +1,85 @@
 package rpc
 
 import (
+	"context"
 	"reflect"
+	"runtime/debug"
 
 	"github.com/polariseye/rpc-go/log"
 )
 
 type MethodInfo struct {
 	MethodName      string
+	MethodId        uint32 //// 根据方法名计算的方法Id，可以代替方法名进行传输
 	FuncObj         reflect.Value
 	funcParamList   []reflect.Type
 	returnValueList []reflect.Type
+
+	isNeedContext bool //// 第二个参数是否是context.Context
+	isReturnError bool //// 最后一个返回值是否是error
+
+	funcName     string       //// 不包含模块名的方法名
+	executeMode  ExecuteMode  //// 执行方式
+	orderKeyFunc OrderKeyFunc //// 排序Key提取函数，为nil则以连接为Key
+}
+
+// 获取排序Key，同一Key的请求会串行执行
+// Key提取函数异常时返回PanicError，Key不可比较时返回ParamError，避免影响请求接收协程
+func (this *MethodInfo) getOrderKey(connObj RpcConnectioner, paramList []reflect.Value) (key interface{}, err error) {
+	if this.orderKeyFunc == nil {
+		return connObj.ConnectionId(), nil
+	}
+
+	defer func() {
+		if tmpErr := recover(); tmpErr != nil {
+			panicErr := &PanicError{
+				Value: tmpErr,
+				Stack: debug.Stack(),
+			}
+			key, err = nil, panicErr
+			log.Error("order key func panic ip:%v MethodName:%v error:%v stack:%s", connObj.Addr(), this.MethodName, panicErr.Error(), panicErr.Stack)
+		}
+	}()
+
+	valList := make([]interface{}, 0, len(paramList))
+	for i := this.getParamStartIndex(); i < len(paramList); i++ {
+		valList = append(valList, paramList[i].Interface())
+	}
+
+	key = this.orderKeyFunc(connObj, valList)
+
+	// Key需要作为map的Key使用，切片、map等不可比较的值会导致异常
+	if key != nil && reflect.ValueOf(key).Comparable() == false {
+		log.Error("order key not comparable ip:%v MethodName:%v type:%T", connObj.Addr(), this.MethodName, key)
+		return nil, &ParamError{Index: -1, Type: reflect.TypeOf(key), Err: OrderKeyError}
+	}
+
+	return key, nil
+}
+
+// 获取需要从请求数据中反序列化的参数的起始位置
+func (this *MethodInfo) getParamStartIndex() int {
+	if this.isNeedContext {
+		return 2
+	}
+
+	return 1
 }
 
 // 获取接口调用的参数
-func (this *MethodInfo) GetInvokeParamList(connObj RpcConnectioner, convertor IByteConvertor, data []byte) ([]reflect.Value, error) {
+func (this *MethodInfo) GetInvokeParamList(ctx context.Context, connObj RpcConnectioner, convertor IByteConvertor, data []byte) ([]reflect.Value, error) {
+	startIndex := this.getParamStartIndex()
 	var valList []reflect.Value
-	if len(this.funcParamList) > 1 {
+	if len(this.funcParamList) > startIndex {
 		var err error
-		valList, err = convertor.UnMarhsalType(data, this.funcParamList[1:]...)
+		valList, err = convertor.UnMarhsalType(data, this.funcParamList[startIndex:]...)
 		if err != nil {
 			log.Error("GetInvokeParamList error ip:%v MethodName:%v error:%v", connObj.Addr(), this.MethodName, err.Error())
+
+			// 转换器无法确定出错位置时，统一包装为参数错误
+			if _, ok := err.(*ParamError); ok == false {
+				err = &ParamError{Index: -1, Err: err}
+			}
 			return nil, err
 		}
 	}
@@ -28,8 +87,11 @@ func (this *MethodInfo) GetInvokeParamList(connObj RpcConnectioner, convertor IB
 	// 组装请求数据
 	var callValList = make([]reflect.Value, len(this.funcParamList))
 	callValList[0] = reflect.ValueOf(connObj)
+	if this.isNeedContext {
+		callValList[1] = reflect.ValueOf(&ctx).Elem()
+	}
 	for i := 0; i < len(valList); i++ {
-		callValList[i+1] = valList[i]
+		callValList[i+startIndex] = valList[i]
 	}
 
 	return callValList, nil
@@ -39,22 +101,30 @@ func (this *MethodInfo) GetInvokeParamList(connObj RpcConnectioner, convertor IB
 func (this *MethodInfo) Invoke(connObj RpcConnectioner, paramList []reflect.Value) (responseValue []reflect.Value, err error) {
 	defer func() {
 		if tmpErr := recover(); tmpErr != nil {
-			err = tmpErr.(error)
-			log.Fatal("method call panic ip:%v MethodName:%v error:%v", connObj.Addr(), this.MethodName, err.Error())
+			// 异常值可能是任意类型，统一转换为PanicError
+			panicErr := &PanicError{
+				Value: tmpErr,
+				Stack: debug.Stack(),
+			}
+			responseValue, err = nil, panicErr
+			log.Error("method call panic ip:%v MethodName:%v error:%v stack:%s", connObj.Addr(), this.MethodName, panicErr.Error(), panicErr.Stack)
 		}
 	}()
 
 	responseValue = this.FuncObj.Call(paramList)
+	if this.isReturnError == false {
+		return
+	}
+
 	//// 如果存在错误，则直接返回错误
-	/*
-		errVal := returnValList[len(returnValList)-1]
-		if errVal.IsNil() == false {
-			errObj := errVal.Interface().(error)
-			return nil, errObj
-		}
-	*/
+	errVal := responseValue[len(responseValue)-1]
+	if errVal.IsNil() == false {
+		errObj := errVal.Interface().(error)
+		return nil, errObj
+	}
 
-	// responseValue=responseValue[:len(returnValList)-1] //// 如果要支持error 需要把这儿打开
+	// 错误不参与序列化
+	responseValue = responseValue[:len(responseValue)-1]
 	return
 }
 
@@ -69,11 +139,20 @@ func (this *MethodInfo) GetResponseBytes(connObj *RpcConnection, responseList []
 	return
 }
 
-func newMethodInfo(methodName string, funcObj reflect.Value, paramList []reflect.Type, returnValList []reflect.Type) *MethodInfo {
+func newMethodInfo(methodName string, funcName string, funcObj reflect.Value, paramList []reflect.Type, returnValList []reflect.Type) *MethodInfo {
+	// 最后一个返回值是error时，作为RPC错误返回，不作为应答数据
+	isReturnError := len(returnValList) > 0 && returnValList[len(returnValList)-1] == ErrorType
+	if isReturnError {
+		returnValList = returnValList[:len(returnValList)-1]
+	}
+
 	return &MethodInfo{
 		MethodName:      methodName,
+		funcName:        funcName,
 		FuncObj:         funcObj,
 		funcParamList:   paramList,
 		returnValueList: returnValList,
+		isNeedContext:   len(paramList) > 1 && paramList[1] == ContextType,
+		isReturnError:   isReturnError,
 	}
 }
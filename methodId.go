@@ -0,0 +1,8 @@
+package rpc
+
+import "hash/crc32"
+
+// getMethodId 根据方法名计算方法Id，同一方法名在任何进程中得到的Id都相同
+func getMethodId(methodName string) uint32 {
+	return crc32.ChecksumIEEE([]byte(methodName))
+}
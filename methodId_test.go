@@ -0,0 +1,119 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMethodNameList(t *testing.T) {
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Tst", func(connObj RpcConnectioner) {})
+
+	methodNameList := apiMgr.getMethodNameList()
+	if len(methodNameList) != 1 || methodNameList[0] != "Sample_Tst" {
+		t.Errorf("method name list:%v", methodNameList)
+		return
+	}
+
+	methodObj, exist := apiMgr.getMethodById(getMethodId(methodNameList[0]))
+	if exist == false || methodObj.MethodName != "Sample_Tst" {
+		t.Errorf("method id not match:%v", methodNameList)
+	}
+}
+
+// Sample_sgxnDxSukNOr与Sample_MceHPMISCxux的CRC32相同
+func TestMethodIdConflict(t *testing.T) {
+	if getMethodId("Sample_sgxnDxSukNOr") != getMethodId("Sample_MceHPMISCxux") {
+		t.Errorf("method id not conflict")
+		return
+	}
+
+	// 注册时检查冲突
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "sgxnDxSukNOr", func(connObj RpcConnectioner) string { return "sgxnDxSukNOr" })
+	func() {
+		defer func() {
+			if err := recover(); err == nil {
+				t.Errorf("register conflict method id should fail")
+			}
+		}()
+		apiMgr.RegisterFunc("Sample", "MceHPMISCxux", func(connObj RpcConnectioner) string { return "MceHPMISCxux" })
+	}()
+
+	clientCon, serverCon := net.Pipe()
+	serverObj := newRpcConnection4Server(serverCon, apiMgr, binary.LittleEndian, GetJsonConvertor)
+	serverObj.start()
+	defer serverObj.Close()
+
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	clientObj.SetUseMethodId(true)
+	if err := clientObj.Start2(clientCon); err != nil {
+		t.Errorf("start error:%v", err)
+		return
+	}
+	defer clientObj.Close()
+
+	// 对方没有注册的方法，即使方法Id相同也使用方法名，不会调用到Id相同的其他方法
+	var value string
+	if err := clientObj.Call("Sample_MceHPMISCxux", nil, []interface{}{&value}); errors.Is(err, MethodNotFoundError) == false {
+		t.Errorf("expect MethodNotFoundError but got:%v value:%v", err, value)
+	}
+	if err := clientObj.Call("Sample_sgxnDxSukNOr", nil, []interface{}{&value}); err != nil || value != "sgxnDxSukNOr" {
+		t.Errorf("call error:%v value:%v", err, value)
+	}
+}
+
+func TestUseMethodId(t *testing.T) {
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Echo", func(connObj RpcConnectioner, value string) string { return value })
+
+	clientCon, serverCon := net.Pipe()
+	serverObj := newRpcConnection4Server(serverCon, apiMgr, binary.LittleEndian, GetJsonConvertor)
+	var methodIdCount, methodNameCount int32
+	serverObj.AddBeforeHandleFrameHandler("test", func(connObj RpcConnectioner, frameObj *DataFrame) (isHandled bool, err error) {
+		if frameObj.TransformType() != TransformType_Nomal || frameObj.ResponseFrameId != 0 {
+			return
+		}
+
+		if frameObj.MethodId != 0 && frameObj.MethodNameLen == 0 {
+			atomic.AddInt32(&methodIdCount, 1)
+		} else if frameObj.MethodId == 0 {
+			atomic.AddInt32(&methodNameCount, 1)
+		}
+		return
+	})
+	serverObj.start()
+	defer serverObj.Close()
+
+	// 握手完成后即可使用方法Id，不需要额外的调用
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	clientObj.SetUseMethodId(true)
+	if err := clientObj.Start2(clientCon); err != nil {
+		t.Errorf("start error:%v", err)
+		return
+	}
+	defer clientObj.Close()
+
+	var value string
+	if err := clientObj.Call("Sample_Echo", []interface{}{"a"}, []interface{}{&value}); err != nil || value != "a" {
+		t.Errorf("call error:%v value:%v", err, value)
+	}
+
+	// 对方不能识别的方法使用方法名
+	if err := clientObj.Call("Sample_NotExist", nil, nil); errors.Is(err, MethodNotFoundError) == false {
+		t.Errorf("expect MethodNotFoundError but got:%v", err)
+	}
+
+	// 关闭后使用方法名
+	clientObj.SetUseMethodId(false)
+	if err := clientObj.Call("Sample_Echo", []interface{}{"b"}, []interface{}{&value}); err != nil || value != "b" {
+		t.Errorf("call error:%v value:%v", err, value)
+	}
+
+	if idCount, nameCount := atomic.LoadInt32(&methodIdCount), atomic.LoadInt32(&methodNameCount); idCount != 1 || nameCount != 2 {
+		t.Errorf("method id count:%v method name count:%v", idCount, nameCount)
+	}
+}
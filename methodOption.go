@@ -0,0 +1,60 @@
+package rpc
+
+// 方法的执行方式，只在请求分发方式不是DispatchMode_Serial时有意义
+type ExecuteMode int
+
+const (
+	// 可以并发执行(默认)
+	ExecuteMode_Concurrent ExecuteMode = iota
+
+	// 相同Key的请求按接收顺序串行执行
+	ExecuteMode_Ordered
+)
+
+// 排序Key提取函数
+// connObj:连接对象
+// paramList:反序列化后的请求参数(不包含连接对象和context.Context)
+type OrderKeyFunc func(connObj RpcConnectioner, paramList []interface{}) interface{}
+
+// 注册方法时使用的选项
+type MethodOption func(methodObj *MethodInfo)
+
+// WithOrdered 同一连接内的所有Ordered方法按接收顺序串行执行
+// 每个连接等待串行执行的请求超过1024个时应答ServerBusyError
+func WithOrdered() MethodOption {
+	return func(methodObj *MethodInfo) {
+		methodObj.executeMode = ExecuteMode_Ordered
+		methodObj.orderKeyFunc = nil
+	}
+}
+
+// WithOrderedKey 同一连接内，Key相同的请求按接收顺序串行执行，等待数量的限制与WithOrdered相同
+// keyFunc:Key提取函数，返回值必须可以作为map的Key；异常时应答PanicError，返回不可比较的值时应答ParamError
+func WithOrderedKey(keyFunc OrderKeyFunc) MethodOption {
+	return func(methodObj *MethodInfo) {
+		methodObj.executeMode = ExecuteMode_Ordered
+		methodObj.orderKeyFunc = keyFunc
+	}
+}
+
+// WithConcurrent 方法可以并发执行
+func WithConcurrent() MethodOption {
+	return func(methodObj *MethodInfo) {
+		methodObj.executeMode = ExecuteMode_Concurrent
+		methodObj.orderKeyFunc = nil
+	}
+}
+
+// ForMethod 选项只对指定方法生效，一般用于RegisterService
+// methodName:方法名，可以是结构体的方法名(如:StringTst3)，也可以是完整的方法名(如:Sample_StringTst3)
+func ForMethod(methodName string, optionList ...MethodOption) MethodOption {
+	return func(methodObj *MethodInfo) {
+		if methodObj.MethodName != methodName && methodObj.funcName != methodName {
+			return
+		}
+
+		for _, item := range optionList {
+			item(methodObj)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// 已注册的内存监听，key:名称
+var (
+	pipeListenerData        = make(map[string]*PipeListener, 8)
+	pipeListenerDataLockObj sync.Mutex
+)
+
+// 内存监听地址
+type pipeAddr string
+
+func (this pipeAddr) Network() string {
+	return AddrScheme_Mem
+}
+
+func (this pipeAddr) String() string {
+	return AddrScheme_Mem + "://" + string(this)
+}
+
+// 内存监听，使用net.Pipe创建连接，不占用端口，用于测试
+// 同时实现了Dialer，可以直接设置到RpcClient
+type PipeListener struct {
+	name         string
+	isRegistered bool
+	conChan      chan net.Conn
+	closeChan    chan struct{}
+	closeOnce    sync.Once
+}
+
+// Accept 等待新连接
+func (this *PipeListener) Accept() (net.Conn, error) {
+	select {
+	case con := <-this.conChan:
+		return con, nil
+	case <-this.closeChan:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close 关闭监听，已建立的连接不受影响
+func (this *PipeListener) Close() error {
+	this.closeOnce.Do(func() {
+		close(this.closeChan)
+
+		if this.isRegistered {
+			pipeListenerDataLockObj.Lock()
+			delete(pipeListenerData, this.name)
+			pipeListenerDataLockObj.Unlock()
+		}
+	})
+
+	return nil
+}
+
+func (this *PipeListener) Addr() net.Addr {
+	return pipeAddr(this.name)
+}
+
+// Dial 创建一个连接到此监听的连接，addr不使用
+func (this *PipeListener) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	serverCon, clientCon := net.Pipe()
+	select {
+	case this.conChan <- serverCon:
+		return clientCon, nil
+	case <-this.closeChan:
+	case <-ctx.Done():
+	}
+
+	serverCon.Close()
+	clientCon.Close()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return nil, &net.OpError{Op: "dial", Net: AddrScheme_Mem, Addr: this.Addr(), Err: net.ErrClosed}
+}
+
+// NewPipeListener 新建内存监听，不会注册到mem://地址中，需要通过Dial或设置为RpcClient的Dialer来连接
+func NewPipeListener(name string) *PipeListener {
+	return &PipeListener{
+		name:      name,
+		conChan:   make(chan net.Conn),
+		closeChan: make(chan struct{}),
+	}
+}
+
+// listenPipe 新建内存监听，并注册到mem://地址中，关闭后取消注册
+func listenPipe(name string) (net.Listener, error) {
+	pipeListenerDataLockObj.Lock()
+	defer pipeListenerDataLockObj.Unlock()
+
+	if _, exist := pipeListenerData[name]; exist {
+		return nil, &net.OpError{Op: "listen", Net: AddrScheme_Mem, Addr: pipeAddr(name), Err: AddrInUseError}
+	}
+
+	result := NewPipeListener(name)
+	result.isRegistered = true
+	pipeListenerData[name] = result
+
+	return result, nil
+}
+
+// dialPipe 连接到mem://地址中注册的内存监听
+func dialPipe(ctx context.Context, name string) (net.Conn, error) {
+	pipeListenerDataLockObj.Lock()
+	listenerObj, exist := pipeListenerData[name]
+	pipeListenerDataLockObj.Unlock()
+
+	if exist == false {
+		return nil, &net.OpError{Op: "dial", Net: AddrScheme_Mem, Addr: pipeAddr(name), Err: AddrNotFoundError}
+	}
+
+	return listenerObj.Dial(ctx, name)
+}
+
+// NewPipePair 通过内存连接把服务端和客户端连接起来，客户端开启自动重连
+// 连接与tcp连接一样支持事件、心跳和断线重连
+// 返回值:
+// closeFunc:关闭客户端和内存监听，并等待服务端在此监听上的处理结束；服务端对象由调用方负责关闭，可以继续在其他监听上使用
+// err:错误信息
+func NewPipePair(serverObj *RpcServer, clientObj *RpcClient) (closeFunc func(), err error) {
+	listenerObj := NewPipeListener("pipe")
+	startDoneChan := make(chan struct{})
+	go func() {
+		defer close(startDoneChan)
+		serverObj.Start2(listenerObj)
+	}()
+
+	closeFunc = func() {
+		clientObj.Close()
+		listenerObj.Close()
+		<-startDoneChan
+	}
+
+	clientObj.SetDialer(listenerObj)
+	if err = clientObj.Start(listenerObj.Addr().String(), true); err != nil {
+		closeFunc()
+		return nil, err
+	}
+
+	return closeFunc, nil
+}
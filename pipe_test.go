@@ -0,0 +1,97 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPipePair(t *testing.T) {
+	t.Parallel()
+
+	var newConnectionCount int32
+	serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+	serverObj.RegisterFunc("Sample", "Echo", func(connObj RpcConnectioner, value int) int { return value })
+	serverObj.AddNewConnectionHandler("Test", func(connObj RpcConnectioner) error {
+		atomic.AddInt32(&newConnectionCount, 1)
+		return nil
+	})
+
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	connectedChan := newConnectedChan(clientObj)
+	closeFunc, err := NewPipePair(serverObj, clientObj)
+	if err != nil {
+		t.Errorf("new pipe pair error:%v", err)
+		return
+	}
+	defer serverObj.Close()
+	waitConnectedChan(connectedChan)
+
+	var value int
+	if err = clientObj.Call("Sample_Echo", []interface{}{1}, []interface{}{&value}); err != nil || value != 1 {
+		t.Errorf("call error:%v value:%v", err, value)
+		return
+	}
+
+	// 断线重连
+	clientObj.Conn().Close()
+	if waitConnectedChan(connectedChan) == false {
+		t.Errorf("reconnect timeout")
+		return
+	}
+
+	err = clientObj.Call("Sample_Echo", []interface{}{2}, []interface{}{&value})
+	if err != nil || value != 2 || atomic.LoadInt32(&newConnectionCount) != 2 {
+		t.Errorf("call after reconnect error:%v value:%v newConnectionCount:%v", err, value, newConnectionCount)
+	}
+
+	// 关闭后客户端不能再重连，服务端在此监听上的处理已结束
+	closeFunc()
+	if clientObj.IsClosed() == false {
+		t.Errorf("client should be closed")
+	}
+	serverObj.listenerLockObj.Lock()
+	listenerCount := len(serverObj.listenerData)
+	serverObj.listenerLockObj.Unlock()
+	if listenerCount != 0 {
+		t.Errorf("server listener count:%v", listenerCount)
+	}
+}
+
+func TestPipeAddr(t *testing.T) {
+	t.Parallel()
+
+	addr := "mem://TestPipeAddr"
+	listenerObj, err := listen(addr)
+	if err != nil {
+		t.Errorf("listen error:%v", err)
+		return
+	}
+	if _, err = listen(addr); errors.Is(err, AddrInUseError) == false {
+		t.Errorf("listen again should be in use error:%v", err)
+	}
+
+	serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+	serverObj.RegisterFunc("Sample", "Echo", func(connObj RpcConnectioner, value int) int { return value })
+	go serverObj.Start2(listenerObj)
+
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	if err = clientObj.Start(addr, false); err != nil {
+		t.Errorf("start error:%v", err)
+		return
+	}
+	defer clientObj.Close()
+
+	var value int
+	if err = clientObj.Call("Sample_Echo", []interface{}{1}, []interface{}{&value}); err != nil || value != 1 {
+		t.Errorf("call error:%v value:%v", err, value)
+	}
+
+	// 关闭后取消注册
+	listenerObj.Close()
+	if _, err = dialPipe(context.Background(), "TestPipeAddr"); errors.Is(err, AddrNotFoundError) == false {
+		t.Errorf("dial closed listener should be not found error:%v", err)
+	}
+}
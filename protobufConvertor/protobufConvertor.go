@@ -17,6 +17,10 @@ type Protobuffer interface {
 	Size() (n int)
 }
 
+func (this *ProtobufConvertor) Name() string {
+	return "protobuf"
+}
+
 func (this *ProtobufConvertor) MarshalValue(valList ...interface{}) ([]byte, error) {
 	var lensBytes = make([]byte, 4)
 	byteData := make([]byte, 0, 2040)
@@ -85,13 +89,28 @@ func (this *ProtobufConvertor) UnMarhsalType(bytesData []byte, typeList ...refle
 		result = append(result, valItem.Elem())
 	}
 
-	return result, this.UnMarhsalValue(bytesData, data...)
+	index, err := this.unMarhsalValue(bytesData, data...)
+	if err != nil {
+		return nil, &rpc.ParamError{Index: index, Type: typeList[index], Err: err}
+	}
+
+	return result, nil
 }
 
 func (this *ProtobufConvertor) UnMarhsalValue(bytesData []byte, valList ...interface{}) error {
+	_, err := this.unMarhsalValue(bytesData, valList...)
+	return err
+}
+
+// unMarhsalValue 反序列化数据，出错时返回出错的位置
+func (this *ProtobufConvertor) unMarhsalValue(bytesData []byte, valList ...interface{}) (int, error) {
 	var handledLen uint32
 	var dataLen uint32
-	for _, valItem := range valList {
+	// handledLen不会超过数据长度，使用减法比较，避免对方发送的长度过大时加法溢出
+	for index, valItem := range valList {
+		if uint32(len(bytesData))-handledLen < 4 {
+			return index, rpc.InnerDataError
+		}
 		dataLen = this.byteOrder.Uint32(bytesData[handledLen : handledLen+4])
 		handledLen += 4
 		if dataLen == 0 {
@@ -101,18 +120,21 @@ func (this *ProtobufConvertor) UnMarhsalValue(bytesData []byte, valList ...inter
 
 		pbItem, ok := valItem.(Protobuffer)
 		if ok == false {
-			return rpc.NotSupportedTypeError
+			return index, rpc.NotSupportedTypeError
 		}
 
+		if dataLen > uint32(len(bytesData))-handledLen {
+			return index, rpc.InnerDataError
+		}
 		err := pbItem.Unmarshal(bytesData[handledLen : handledLen+dataLen])
 		if err != nil {
-			return err
+			return index, err
 		}
 
 		handledLen += dataLen
 	}
 
-	return nil
+	return -1, nil
 }
 
 func newProtobufConvertor(byteOrder binary.ByteOrder) *ProtobufConvertor {
@@ -0,0 +1,66 @@
+package protobufConvertor
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/polariseye/rpc-go"
+)
+
+// 直接保存原始数据的消息，用于测试长度前缀的处理
+type rawMessage struct {
+	data []byte
+}
+
+func (this *rawMessage) Marshal() ([]byte, error) {
+	return this.data, nil
+}
+
+func (this *rawMessage) Unmarshal(data []byte) error {
+	this.data = append([]byte(nil), data...)
+	return nil
+}
+
+func (this *rawMessage) Size() int {
+	return len(this.data)
+}
+
+func TestProtobufConvertor(t *testing.T) {
+	convertorObj := newProtobufConvertor(binary.LittleEndian)
+	bytesData, err := convertorObj.MarshalValue(&rawMessage{data: []byte("abc")}, &rawMessage{data: []byte("de")})
+	if err != nil {
+		t.Errorf("marshal error:%v", err)
+		return
+	}
+
+	item1, item2 := &rawMessage{}, &rawMessage{}
+	if err = convertorObj.UnMarhsalValue(bytesData, item1, item2); err != nil || string(item1.data) != "abc" || string(item2.data) != "de" {
+		t.Errorf("unmarshal error:%v item1:%s item2:%s", err, item1.data, item2.data)
+	}
+
+	// 数据不完整
+	if err = convertorObj.UnMarhsalValue(bytesData[:len(bytesData)-1], item1, item2); errors.Is(err, rpc.InnerDataError) == false {
+		t.Errorf("expect InnerDataError but got:%v", err)
+	}
+}
+
+func TestProtobufConvertorHugeLength(t *testing.T) {
+	convertorObj := newProtobufConvertor(binary.LittleEndian)
+
+	// 长度前缀为0xFFFFFFFF时加法会溢出，需要返回错误而不是越界
+	for _, dataLen := range []uint32{0xFFFFFFFF, 0xFFFFFFFC, 5} {
+		bytesData := binary.LittleEndian.AppendUint32(nil, dataLen)
+		bytesData = append(bytesData, 1, 2, 3)
+		if err := convertorObj.UnMarhsalValue(bytesData, &rawMessage{}); errors.Is(err, rpc.InnerDataError) == false {
+			t.Errorf("length:%x expect InnerDataError but got:%v", dataLen, err)
+		}
+	}
+
+	// 第二个参数的长度前缀不完整
+	bytesData := binary.LittleEndian.AppendUint32(nil, 1)
+	bytesData = append(bytesData, 1, 0xFF, 0xFF)
+	if err := convertorObj.UnMarhsalValue(bytesData, &rawMessage{}, &rawMessage{}); errors.Is(err, rpc.InnerDataError) == false {
+		t.Errorf("expect InnerDataError but got:%v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// 错误码，小于ErrorCode_Custom的错误码由框架使用，业务错误码需要大于等于ErrorCode_Custom
+const (
+	// 未知错误，处理函数返回的普通error使用此错误码
+	ErrorCode_Unknown int32 = 1
+
+	ErrorCode_MethodNotFound   int32 = 2
+	ErrorCode_InnerData        int32 = 3
+	ErrorCode_CallTimeout      int32 = 4
+	ErrorCode_ServerBusy       int32 = 5
+	ErrorCode_NotSupportedType int32 = 6
+	ErrorCode_ConnectionClosed int32 = 7
+	ErrorCode_ParamDecode      int32 = 8
+	ErrorCode_HandlerPanic     int32 = 9
+	ErrorCode_FrameTooLarge    int32 = 10
+	ErrorCode_GoingAway        int32 = 11
+
+	// 业务错误码的起始值
+	ErrorCode_Custom int32 = 1000
+)
+
+// 错误码对应的框架错误
+var errorCodeData = map[int32]error{
+	ErrorCode_MethodNotFound:   MethodNotFoundError,
+	ErrorCode_InnerData:        InnerDataError,
+	ErrorCode_CallTimeout:      CallTimeoutError,
+	ErrorCode_ServerBusy:       ServerBusyError,
+	ErrorCode_NotSupportedType: NotSupportedTypeError,
+	ErrorCode_ConnectionClosed: ConnectionClosedError,
+	ErrorCode_ParamDecode:      ParamDecodeError,
+	ErrorCode_HandlerPanic:     HandlerPanicError,
+	ErrorCode_FrameTooLarge:    FrameTooLargeError,
+	ErrorCode_GoingAway:        GoingAwayError,
+}
+
+// 错误应答的详细程度
+type ErrorDetailLevel int
+
+const (
+	// 隐藏内部细节，只返回错误码、通用的错误信息以及出错的参数位置和类型(默认)，处理函数返回的RemoteError原样返回，用于正式环境
+	ErrorDetailLevel_Simple ErrorDetailLevel = iota
+
+	// 返回完整的错误信息，用于开发环境
+	ErrorDetailLevel_Full
+)
+
+// 参数反序列化错误，可以使用errors.Is(err, ParamDecodeError)判断
+type ParamError struct {
+	Index int          //// 出错的参数位置(从0开始，不包含连接对象和context.Context)，-1表示无法确定
+	Type  reflect.Type //// 参数需要反序列化成的类型，可能为nil
+	Err   error        //// 具体错误
+}
+
+func (this *ParamError) Error() string {
+	return fmt.Sprintf("ParamDecodeError Index:%v Type:%v error:%v", this.Index, this.Type, this.Err)
+}
+
+func (this *ParamError) Is(target error) bool {
+	return target == ParamDecodeError
+}
+
+func (this *ParamError) Unwrap() error {
+	return this.Err
+}
+
+// 处理函数异常，可以使用errors.Is(err, HandlerPanicError)判断
+type PanicError struct {
+	Value interface{} //// recover得到的值
+	Stack []byte      //// 异常时的调用栈
+}
+
+func (this *PanicError) Error() string {
+	return fmt.Sprintf("HandlerPanicError:%v", this.Value)
+}
+
+func (this *PanicError) Is(target error) bool {
+	return target == HandlerPanicError
+}
+
+func (this *PanicError) Unwrap() error {
+	if err, ok := this.Value.(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// 远端返回的错误，处理函数也可以返回此错误以便把业务错误码传递给调用方
+type RemoteError struct {
+	Code    int32             //// 错误码
+	Message string            //// 错误信息
+	Details map[string]string `json:",omitempty"` //// 错误详情
+}
+
+func (this *RemoteError) Error() string {
+	if this.Message == "" {
+		return fmt.Sprintf("RemoteError Code:%v", this.Code)
+	}
+
+	return this.Message
+}
+
+// Unwrap 框架错误码会映射为const.go中对应的错误，以便使用errors.Is判断
+func (this *RemoteError) Unwrap() error {
+	return errorCodeData[this.Code]
+}
+
+// WithDetail 添加错误详情
+func (this *RemoteError) WithDetail(key string, value string) *RemoteError {
+	if this.Details == nil {
+		this.Details = make(map[string]string, 4)
+	}
+
+	this.Details[key] = value
+	return this
+}
+
+// NewRemoteError 新建一个远端错误
+// code:错误码，业务错误码需要大于等于ErrorCode_Custom
+// message:错误信息
+func NewRemoteError(code int32, message string) *RemoteError {
+	return &RemoteError{
+		Code:    code,
+		Message: message,
+	}
+}
+
+// toRemoteError 把错误转换为可传输的远端错误
+// detailLevel:错误的详细程度，ErrorDetailLevel_Simple时除RemoteError外只返回错误码和通用的错误信息，避免泄露内部信息
+func toRemoteError(err error, detailLevel ErrorDetailLevel) *RemoteError {
+	var remoteErr *RemoteError
+	if errors.As(err, &remoteErr) {
+		return remoteErr
+	}
+
+	// 参数错误
+	var paramErr *ParamError
+	if errors.As(err, &paramErr) {
+		remoteErr = NewRemoteError(ErrorCode_ParamDecode, ParamDecodeError.Error())
+		remoteErr.WithDetail("index", strconv.Itoa(paramErr.Index))
+		if paramErr.Type != nil {
+			remoteErr.WithDetail("type", paramErr.Type.String())
+		}
+		if detailLevel == ErrorDetailLevel_Full {
+			remoteErr.Message = paramErr.Error()
+		}
+
+		return remoteErr
+	}
+
+	// 处理函数异常
+	if errors.Is(err, HandlerPanicError) {
+		if detailLevel == ErrorDetailLevel_Full {
+			remoteErr = NewRemoteError(ErrorCode_HandlerPanic, err.Error())
+
+			var panicErr *PanicError
+			if errors.As(err, &panicErr) {
+				remoteErr.WithDetail("stack", string(panicErr.Stack))
+			}
+
+			return remoteErr
+		}
+
+		return NewRemoteError(ErrorCode_HandlerPanic, HandlerPanicError.Error())
+	}
+
+	for code, item := range errorCodeData {
+		if errors.Is(err, item) {
+			if detailLevel == ErrorDetailLevel_Full {
+				return NewRemoteError(code, err.Error())
+			}
+
+			return NewRemoteError(code, item.Error())
+		}
+	}
+
+	if detailLevel == ErrorDetailLevel_Full {
+		return NewRemoteError(ErrorCode_Unknown, err.Error())
+	}
+
+	return NewRemoteError(ErrorCode_Unknown, "UnknownError")
+}
+
+// marshalError 把错误序列化为错误帧的内容
+func marshalError(err error, detailLevel ErrorDetailLevel) []byte {
+	bytesData, tmpErr := json.Marshal(toRemoteError(err, detailLevel))
+	if tmpErr != nil {
+		return []byte(err.Error())
+	}
+
+	return bytesData
+}
+
+// unmarshalError 从错误帧的内容还原错误，无法解析时把内容作为错误信息
+func unmarshalError(data []byte) error {
+	remoteErr := new(RemoteError)
+	if err := json.Unmarshal(data, remoteErr); err != nil || remoteErr.Code == 0 {
+		return errors.New(string(data))
+	}
+
+	return remoteErr
+}
@@ -0,0 +1,155 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRemoteError(t *testing.T) {
+	// 框架错误需要能还原为对应的错误
+	err := unmarshalError(marshalError(fmt.Errorf("call:%w", MethodNotFoundError), ErrorDetailLevel_Simple))
+	if errors.Is(err, MethodNotFoundError) == false {
+		t.Errorf("expect MethodNotFoundError but got:%v", err)
+		return
+	}
+
+	// 业务错误需要保留错误码和详情
+	err = unmarshalError(marshalError(NewRemoteError(ErrorCode_Custom+1, "biz error").WithDetail("userId", "42"), ErrorDetailLevel_Simple))
+	var remoteErr *RemoteError
+	if errors.As(err, &remoteErr) == false {
+		t.Errorf("expect RemoteError but got:%v", err)
+		return
+	}
+	if remoteErr.Code != ErrorCode_Custom+1 || remoteErr.Message != "biz error" || remoteErr.Details["userId"] != "42" {
+		t.Errorf("remote error not match:%+v", remoteErr)
+		return
+	}
+
+	// 简单模式下，非RemoteError只返回错误码和通用的错误信息
+	err = unmarshalError(marshalError(fmt.Errorf("call:%w", MethodNotFoundError), ErrorDetailLevel_Simple))
+	if err.Error() != MethodNotFoundError.Error() {
+		t.Errorf("simple error message:%v", err)
+	}
+	err = unmarshalError(marshalError(errors.New("db password error"), ErrorDetailLevel_Simple))
+	if errors.As(err, &remoteErr) == false || remoteErr.Code != ErrorCode_Unknown || remoteErr.Message != "UnknownError" {
+		t.Errorf("simple unknown error:%v", err)
+	}
+	err = unmarshalError(marshalError(errors.New("db password error"), ErrorDetailLevel_Full))
+	if err.Error() != "db password error" {
+		t.Errorf("full unknown error:%v", err)
+	}
+
+	// 兼容只有错误信息的错误帧
+	err = unmarshalError([]byte("InnerDataError"))
+	if err.Error() != "InnerDataError" {
+		t.Errorf("expect InnerDataError but got:%v", err)
+	}
+}
+
+func TestHandlerError(t *testing.T) {
+	bizErr := NewRemoteError(ErrorCode_Custom+1, "biz error")
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Get", func(connObj RpcConnectioner, isError bool) (string, error) {
+		if isError {
+			return "", bizErr
+		}
+
+		return "ok", nil
+	})
+	apiMgr.RegisterFunc("Sample", "Plain", func(connObj RpcConnectioner) error {
+		return errors.New("plain error")
+	})
+
+	serverObj, clientObj := newTestConnectionPair(t, apiMgr)
+	defer serverObj.Close()
+	defer clientObj.Close()
+
+	// 没有错误时，error不参与序列化
+	var value string
+	if err := clientObj.Call("Sample_Get", []interface{}{false}, []interface{}{&value}); err != nil || value != "ok" {
+		t.Errorf("call error:%v value:%v", err, value)
+	}
+
+	// 返回的错误使用错误标识应答，没有返回值对象时也能得到错误
+	var remoteErr *RemoteError
+	err := clientObj.Call("Sample_Get", []interface{}{true}, nil)
+	if errors.As(err, &remoteErr) == false || remoteErr.Code != bizErr.Code || remoteErr.Message != bizErr.Message {
+		t.Errorf("expect biz error but got:%v", err)
+	}
+
+	// 普通error使用ErrorCode_Unknown
+	err = clientObj.Call("Sample_Plain", nil, nil)
+	if errors.As(err, &remoteErr) == false || remoteErr.Code != ErrorCode_Unknown {
+		t.Errorf("expect unknown error but got:%v", err)
+	}
+}
+
+func TestParamErrorResponse(t *testing.T) {
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Set", func(connObj RpcConnectioner, name string, count int) {})
+
+	serverObj, clientObj := newTestConnectionPair(t, apiMgr)
+	defer serverObj.Close()
+	defer clientObj.Close()
+
+	// 参数错误需要带上出错的参数位置和类型
+	var remoteErr *RemoteError
+	err := clientObj.Call("Sample_Set", []interface{}{"a", "b"}, nil)
+	if errors.Is(err, ParamDecodeError) == false || errors.As(err, &remoteErr) == false {
+		t.Errorf("expect ParamDecodeError but got:%v", err)
+		return
+	}
+	if remoteErr.Code != ErrorCode_ParamDecode || remoteErr.Details["index"] != "1" || remoteErr.Details["type"] != "int" {
+		t.Errorf("param error not match:%+v", remoteErr)
+	}
+
+	// 框架错误可以还原为对应的错误
+	if err = clientObj.Call("Sample_NotExist", nil, nil); errors.Is(err, MethodNotFoundError) == false {
+		t.Errorf("expect MethodNotFoundError but got:%v", err)
+	}
+}
+
+func TestHandlerPanic(t *testing.T) {
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Panic", func(connObj RpcConnectioner, isError bool) {
+		if isError {
+			panic(errors.New("panic error"))
+		}
+
+		panic("panic value")
+	})
+	apiMgr.RegisterFunc("Sample", "Echo", func(connObj RpcConnectioner, value string) string { return value })
+
+	serverObj, clientObj := newTestConnectionPair(t, apiMgr)
+	defer serverObj.Close()
+	defer clientObj.Close()
+
+	panicChan := make(chan *PanicError, 2)
+	serverObj.AddPanicHandler("test", func(connObj RpcConnectioner, frameObj *DataFrame, panicErr *PanicError) {
+		panicChan <- panicErr
+	})
+
+	// 任意类型的异常值都转换为PanicError，并触发异常事件
+	for _, isError := range []bool{false, true} {
+		if err := clientObj.Call("Sample_Panic", []interface{}{isError}, nil); errors.Is(err, HandlerPanicError) == false {
+			t.Errorf("expect HandlerPanicError but got:%v", err)
+		}
+
+		select {
+		case panicErr := <-panicChan:
+			if len(panicErr.Stack) == 0 || (isError == false && panicErr.Value != "panic value") {
+				t.Errorf("panic error not match value:%v stack:%s", panicErr.Value, panicErr.Stack)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("panic handler not called")
+		}
+	}
+
+	// 异常后连接依然可用
+	var value string
+	if err := clientObj.Call("Sample_Echo", []interface{}{"a"}, []interface{}{&value}); err != nil || value != "a" {
+		t.Errorf("call error:%v value:%v", err, value)
+	}
+}
@@ -1,48 +1,105 @@
 package rpc
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/polariseye/rpc-go/log"
 )
 
+// 自动重连的等待时间，连续失败时从最小值开始翻倍，握手成功后重置
+const (
+	minReconnectInterval = 100 * time.Millisecond
+	maxReconnectInterval = 5 * time.Second
+)
+
+// 停止重连的信号，每次Start都会新建，避免之前的重连协程使用新的连接
+type stopSignal struct {
+	isStopped bool
+	stopChan  chan struct{} //// 停止时关闭，用于中断重连前的等待
+}
+
+// stop 停止，需要在autoReconnectLockObj锁内调用
+func (this *stopSignal) stop() {
+	if this.isStopped {
+		return
+	}
+
+	this.isStopped = true
+	close(this.stopChan)
+}
+
+func newStopSignal() *stopSignal {
+	return &stopSignal{
+		stopChan: make(chan struct{}),
+	}
+}
+
 // 客户端连接对象
 type RpcClient struct {
 	*RpcConnection4Client
 	*ApiMgr
 
-	isAutoReconnect  bool
+	isAutoReconnect  int32 //// 是否自动重连，关闭时会在其他协程中读取，使用原子操作
 	addr             string
 	getConvertorFunc func() IByteConvertor
 
-	isStopped            *bool //// 用指针是为了避免在调用Start时，正在进行重连
+	stopSignalObj        *stopSignal   //// 用指针是为了避免在调用Start时，正在进行重连
+	reconnectInterval    time.Duration //// 下次重连前的等待时间
 	autoReconnectLockObj sync.Mutex
 	byteOrder            binary.ByteOrder
+	dispatchConfig       DispatchConfig    //// 请求分发配置，重连后依然有效
+	errorDetailLevel     ErrorDetailLevel  //// 错误应答的详细程度，重连后依然有效
+	headerVersion        byte              //// 发送时可以使用的最高协议头版本，重连后依然有效
+	isUseMethodId        bool              //// 是否使用方法Id代替方法名发送请求，重连后依然有效
+	maxFrameSize         uint32            //// 能接收的最大帧长度，重连后依然有效
+	frameSizeAction      FrameSizeAction   //// 收到超长帧时的处理方式，重连后依然有效
+	isChecksum           bool              //// 是否需要校验码，重连后依然有效
+	compressionConfig    CompressionConfig //// 压缩配置，重连后依然有效
+	tlsConfig            *tls.Config       //// TLS配置，为nil则不使用TLS，重连后依然有效
+	dialer               Dialer            //// 连接服务端使用的Dialer，为nil则使用tcp，重连后依然有效
 }
 
 // 关闭连接
 // 如果重复调用，将会只生效一次
 func (this *RpcClient) Close() {
-	*this.isStopped = true
-	this.isStopped = new(bool)
-
-	this.RpcConnection4Client.Close()
+	// 关闭连接时会触发重连事件，需要先关闭自动重连
+	this.autoReconnectLockObj.Lock()
+	atomic.StoreInt32(&this.isAutoReconnect, No)
+	this.stopSignalObj.stop()
+	conObj := this.RpcConnection
+	this.autoReconnectLockObj.Unlock()
+
+	// 一直没有连接成功时没有连接对象
+	if conObj != nil {
+		conObj.Close()
+	}
 }
 
 // Start 连接到指定地址
-// addr: 服务端地址
+// addr: 服务端地址，支持tcp://、unix://、unix-abstract://、mem://格式，没有指定格式时使用tcp；使用自定义Dialer时由Dialer解析
 // isAutoReconnect: 是否自动重连到服务端
 // 返回值:
 // error:错误信息
 func (this *RpcClient) Start(addr string, isAutoReconnect bool) error {
+	if this.dialer == nil {
+		if _, _, err := parseAddr(addr); err != nil {
+			return err
+		}
+	}
+
 	var result error
+	var stopSignalObj *stopSignal
 	func() {
 		this.autoReconnectLockObj.Lock()
 		defer this.autoReconnectLockObj.Unlock()
 
-		if *this.isStopped == false {
+		if this.stopSignalObj.isStopped == false {
 			result = HaveConnectedError
 			return
 		}
@@ -51,12 +108,18 @@ func (this *RpcClient) Start(addr string, isAutoReconnect bool) error {
 			return
 		}
 
-		// 因为可能重连时会用到isStopped,确保重连协程能够正常退出，所以new一个新对象
-		*this.isStopped = true
-		this.isStopped = new(bool)
+		// 因为可能重连时会用到stopSignalObj,确保重连协程能够正常退出，所以new一个新对象
+		this.stopSignalObj.stop()
+		this.stopSignalObj = newStopSignal()
 
-		this.isAutoReconnect = isAutoReconnect
+		if isAutoReconnect {
+			atomic.StoreInt32(&this.isAutoReconnect, Yes)
+		} else {
+			atomic.StoreInt32(&this.isAutoReconnect, No)
+		}
 		this.addr = addr
+		this.reconnectInterval = 0
+		stopSignalObj = this.stopSignalObj
 	}()
 
 	if result != nil {
@@ -65,13 +128,13 @@ func (this *RpcClient) Start(addr string, isAutoReconnect bool) error {
 
 	// 先尝试连接一次
 	log.Info("start reconnect to %v", addr)
-	if this.connect(this.isStopped, addr) {
-		return nil
+	if isConnected, err := this.connect(stopSignalObj, addr); isConnected || err == ConnectionClosedError {
+		return err
 	}
 
 	if isAutoReconnect {
 		// 开启重连
-		go this.reconnect(this.isStopped)
+		go this.reconnect(stopSignalObj)
 	} else {
 		return ConnectionTimeOut
 	}
@@ -83,26 +146,95 @@ func (this *RpcClient) Start(addr string, isAutoReconnect bool) error {
 // 使用此函数开启处理进，将不会进行断线重连。连接完全由外部处理
 // con:连接对象
 // 返回值:
-// error:错误信息
+// error:错误信息，握手失败时返回失败原因
 func (this *RpcClient) Start2(con net.Conn) error {
-	this.autoReconnectLockObj.Lock()
-	defer this.autoReconnectLockObj.Unlock()
+	var conObj *RpcConnection
+	err := func() error {
+		this.autoReconnectLockObj.Lock()
+		defer this.autoReconnectLockObj.Unlock()
 
-	if *this.isStopped == false {
-		return HaveConnectedError
-	}
-	if this.IsClosed() == false {
-		return HaveConnectedError
+		if this.stopSignalObj.isStopped == false {
+			return HaveConnectedError
+		}
+		if this.IsClosed() == false {
+			return HaveConnectedError
+		}
+
+		// 因为可能重连时会用到stopSignalObj,确保重连协程能够正常退出，所以new一个新对象
+		this.stopSignalObj.stop()
+		this.stopSignalObj = newStopSignal()
+
+		conObj = this.startConnection(con)
+		return nil
+	}()
+	if err != nil {
+		return err
 	}
 
-	// 因为可能重连时会用到isStopped,确保重连协程能够正常退出，所以new一个新对象
-	*this.isStopped = true
-	this.isStopped = new(bool)
+	return this.waitConnected(conObj)
+}
 
+// startConnection 使用连接创建连接对象，并开始处理，需要在autoReconnectLockObj锁内调用
+func (this *RpcClient) startConnection(con net.Conn) *RpcConnection {
 	conObj := newRpcConnection(this.ApiMgr, con, this, this, this.byteOrder, this.getConvertorFunc)
+	conObj.SetDispatchConfig(this.dispatchConfig)
+	conObj.SetErrorDetailLevel(this.errorDetailLevel)
+	conObj.SetHeaderVersion(this.headerVersion)
+	conObj.SetMaxFrameSize(this.maxFrameSize, this.frameSizeAction)
+	conObj.SetChecksum(this.isChecksum)
+	conObj.SetCompression(this.compressionConfig)
+	if this.isUseMethodId {
+		conObj.SetUseMethodId(true)
+	}
 	this.RpcConnection4Client.setConnection(conObj)
+	conObj.start()
 
-	return nil
+	return conObj
+}
+
+// SetDispatchConfig 设置请求分发方式，对当前连接和之后重连的连接都有效
+func (this *RpcClient) SetDispatchConfig(config DispatchConfig) {
+	this.dispatchConfig = config
+	this.RpcConnection.SetDispatchConfig(config)
+}
+
+// SetErrorDetailLevel 设置错误应答的详细程度，对当前连接和之后重连的连接都有效
+func (this *RpcClient) SetErrorDetailLevel(errorDetailLevel ErrorDetailLevel) {
+	this.errorDetailLevel = errorDetailLevel
+	this.RpcConnection.SetErrorDetailLevel(errorDetailLevel)
+}
+
+// SetHeaderVersion 设置能使用的最高协议头版本，默认为HeaderVersion_V2，对之后建立的连接有效
+// 握手时与对方协商，发送时使用双方都支持的最高版本
+func (this *RpcClient) SetHeaderVersion(headerVersion byte) {
+	this.headerVersion = headerVersion
+}
+
+// SetUseMethodId 设置是否使用方法Id代替方法名发送请求，对当前连接和之后重连的连接都有效
+// 对方在握手信息中告知能识别的方法Id，握手完成前以及对方不能识别的方法依然使用方法名
+func (this *RpcClient) SetUseMethodId(isUseMethodId bool) {
+	this.isUseMethodId = isUseMethodId
+	this.RpcConnection.SetUseMethodId(isUseMethodId)
+}
+
+// SetMaxFrameSize 设置能接收的最大帧长度(方法名+内容)，默认为DefaultMaxFrameSize，对之后建立的连接有效
+// 最大帧长度在握手时告知对方，所以不修改已建立的连接
+// maxFrameSize:最大帧长度，0表示不限制
+// action:收到超长帧时的处理方式
+func (this *RpcClient) SetMaxFrameSize(maxFrameSize uint32, action FrameSizeAction) {
+	this.maxFrameSize = maxFrameSize
+	this.frameSizeAction = action
+}
+
+// SetChecksum 设置是否需要校验码，任意一方需要时双方发送的帧都会带上校验码，校验失败的帧会被丢弃
+// 对之后建立的连接有效
+func (this *RpcClient) SetChecksum(isChecksum bool) {
+	this.isChecksum = isChecksum
+}
+
+// SetCompression 设置压缩配置，握手时与对方协商压缩算法，对之后建立的连接有效
+func (this *RpcClient) SetCompression(config CompressionConfig) {
+	this.compressionConfig = config
 }
 
 // Addr 获取服务端地址
@@ -120,42 +252,114 @@ func (this *RpcClient) Addr() string {
 }
 
 // reconnect 重连
-// isStopped:用于判断是否已经停止重连了，使用指针是为了避免调用Start导致多个重连协程的问题
-func (this *RpcClient) reconnect(isStopped *bool) {
-	if this.isAutoReconnect == false {
+// stopSignalObj:用于判断是否已经停止重连了，使用指针是为了避免调用Start导致多个重连协程的问题
+func (this *RpcClient) reconnect(stopSignalObj *stopSignal) {
+	if atomic.LoadInt32(&this.isAutoReconnect) == No {
 		log.Debug("no need auto reconnect")
 		return
 	}
 
 	addr := this.addr
-	for *isStopped == false && this.isAutoReconnect { //// 地址有变更，则立即停止重连
+	for {
+		// 先等待再重连，避免服务端不可用时不停地连接
+		timer := time.NewTimer(this.nextReconnectInterval())
+		select {
+		case <-stopSignalObj.stopChan:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if this.checkStopped(stopSignalObj) || atomic.LoadInt32(&this.isAutoReconnect) == No { //// 地址有变更，则立即停止重连
+			return
+		}
+
 		log.Info("start reconnect to %v", addr)
-		if this.connect(isStopped, addr) {
-			break
+		if isConnected, _ := this.connect(stopSignalObj, addr); isConnected {
+			return
 		}
 	}
 }
 
-// connect
-func (this *RpcClient) connect(isStopped *bool, addr string) bool {
-	con, err := net.Dial("tcp", addr)
-	if err != nil {
-		log.Error("fail to connect to server addr:%v error:%v", addr, err.Error())
-		return false
+// nextReconnectInterval 获取本次重连前的等待时间，并翻倍下次的等待时间
+func (this *RpcClient) nextReconnectInterval() time.Duration {
+	this.autoReconnectLockObj.Lock()
+	defer this.autoReconnectLockObj.Unlock()
+
+	if this.reconnectInterval < minReconnectInterval {
+		this.reconnectInterval = minReconnectInterval
 	}
+	result := this.reconnectInterval
+	this.reconnectInterval = min(this.reconnectInterval*2, maxReconnectInterval)
+
+	return result
+}
+
+// checkStopped 在锁内读取是否已停止重连
+func (this *RpcClient) checkStopped(stopSignalObj *stopSignal) bool {
+	this.autoReconnectLockObj.Lock()
+	defer this.autoReconnectLockObj.Unlock()
+
+	return stopSignalObj.isStopped
+}
 
+// getStopSignal 在锁内获取当前的停止信号
+func (this *RpcClient) getStopSignal() *stopSignal {
 	this.autoReconnectLockObj.Lock()
 	defer this.autoReconnectLockObj.Unlock()
-	if *isStopped {
-		log.Info("change server old server:%v", addr)
-		con.Close()
+
+	return this.stopSignalObj
+}
+
+// connect 连接到服务端，并等待握手完成
+// 对方不兼容或拒绝连接等重试也不会成功的握手失败，会停止自动重连
+// 返回值:
+// isConnected:是否已建立连接，建立连接后，握手失败导致的断线也会触发重连
+// err:握手失败的原因
+func (this *RpcClient) connect(stopSignalObj *stopSignal, addr string) (isConnected bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	con, err := this.getDialer().Dial(ctx, addr)
+	cancel()
+	if err != nil {
+		log.Error("fail to connect to server addr:%v error:%v", addr, err.Error())
+		return false, err
 	}
 
-	conObj := newRpcConnection(this.ApiMgr, con, this, this, this.byteOrder, this.getConvertorFunc)
-	this.RpcConnection4Client.setConnection(conObj)
+	// 连接期间调用了Close或重新Start，不能再使用此连接
+	conObj := func() *RpcConnection {
+		this.autoReconnectLockObj.Lock()
+		defer this.autoReconnectLockObj.Unlock()
+		if stopSignalObj.isStopped {
+			log.Info("change server old server:%v", addr)
+			con.Close()
+			return nil
+		}
+
+		return this.startConnection(con)
+	}()
+	if conObj == nil {
+		return false, ConnectionClosedError
+	}
+
+	err = this.waitConnected(conObj)
+	func() {
+		this.autoReconnectLockObj.Lock()
+		defer this.autoReconnectLockObj.Unlock()
+
+		if err == nil {
+			this.reconnectInterval = 0
+		} else if isHandshakeRetryable(err) == false && stopSignalObj == this.stopSignalObj {
+			atomic.StoreInt32(&this.isAutoReconnect, No)
+			stopSignalObj.stop()
+		}
+	}()
+	if err != nil {
+		log.Error("fail to handshake with server addr:%v error:%v", addr, err.Error())
+		return true, err
+	}
 	log.Info("connected to server:%v", addr)
 
-	return true
+	return true, nil
 }
 
 // NewRpcClient 新建Rpc连接客户端对象
@@ -163,19 +367,21 @@ func (this *RpcClient) connect(isStopped *bool, addr string) bool {
 func NewRpcClient(byteOrder binary.ByteOrder, getConvertorFunc func() IByteConvertor) *RpcClient {
 	result := &RpcClient{
 		ApiMgr:               newApiMgr(),
-		isAutoReconnect:      false,
-		isStopped:            new(bool),
+		isAutoReconnect:      No,
+		stopSignalObj:        newStopSignal(),
 		getConvertorFunc:     getConvertorFunc,
 		RpcConnection4Client: NewRpcConnection4Client(),
 		byteOrder:            byteOrder,
+		headerVersion:        HeaderVersion_V2,
+		maxFrameSize:         DefaultMaxFrameSize,
 	}
 
-	*result.isStopped = true
+	result.stopSignalObj.stop()
 
 	// 添加对自动重连的支持
 	result.AddCloseHandler("RpcClient.reconnect", func(conObj RpcConnectioner) {
-		if result.isAutoReconnect {
-			go result.reconnect(result.isStopped)
+		if atomic.LoadInt32(&result.isAutoReconnect) == Yes {
+			go result.reconnect(result.getStopSignal())
 		}
 
 		return
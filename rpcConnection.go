@@ -1,12 +1,15 @@
 package rpc
 
 import (
+	"context"
+	"crypto/x509"
 	"encoding/binary"
-	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"math/rand"
 	"net"
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -20,9 +23,17 @@ type RpcConnectioner interface {
 	CallAsyncWithNoResponse(methodName string, requestObj []interface{}, responseObj []interface{}) (err error)
 	CallTimeout(methodName string, requestObj []interface{}, responseObj []interface{}, expireMillisecond int64) (err error)
 	CallAsyncTimeout(methodName string, requestObj []interface{}, responseObj []interface{}, expireMillisecond int64) (donChan <-chan error, err error)
+	CallContext(ctx context.Context, methodName string, requestObj []interface{}, responseObj []interface{}) (err error)
+	CallAsyncContext(ctx context.Context, methodName string, requestObj []interface{}, responseObj []interface{}) (donChan <-chan error, err error)
+	CallAsyncWithNoResponseContext(ctx context.Context, methodName string, requestObj []interface{}, responseObj []interface{}) (err error)
 	SetRequestExpireMillisecond(requestExpireMillisecond int64)
+	SetDispatchConfig(config DispatchConfig)
 	Close()
 	Conn() net.Conn
+	PeerCertificates() []*x509.Certificate
+	SetAttr(key string, value interface{})
+	GetAttr(key string) (value interface{}, exist bool)
+	DeleteAttr(key string)
 	Addr() string
 	IsClosed() bool
 	ConnectionId() int64
@@ -49,10 +60,46 @@ type RpcConnection struct {
 	byteOrder        binary.ByteOrder      //// 数据的字节序
 	getConvertorFunc func() IByteConvertor //// 数据转换对象获取
 
-	requestExpireMillisecond int64  // 请求超时时间,单位毫秒
-	requestId                uint32 //// 请求Id，会为每次请求分配一个唯一Id
+	requestExpireMillisecond int64            // 请求超时时间,单位毫秒
+	errorDetailLevel         ErrorDetailLevel // 错误应答的详细程度
+	headerVersion            byte             // 能使用的最高协议头版本，握手时告知对方，在handshakeLockObj锁内读写
+	maxFrameSize             uint32           // 能接收的最大帧长度(方法名+内容)，0表示不限制
+	frameSizeAction          FrameSizeAction  // 收到超长帧时的处理方式
+	isChecksum               bool             // 是否需要校验码
+	checksumErrorCount       int64            // 校验失败的帧数量
+
+	compressionConfig CompressionConfig //// 压缩配置
+	requestId         uint32            //// 请求Id，会为每次请求分配一个唯一Id
+
+	dispatcher          requestDispatcher //// 请求分发器
+	dispatcherLockObj   sync.RWMutex
+	isDispatcherStopped bool          //// 请求处理是否已结束，结束后分发器不再使用
+	orderedQueue        *orderedQueue //// 需要串行执行的请求队列
+
+	isUseMethodId int32 //// 是否使用方法Id代替方法名发送请求，使用原子操作
+
+	handshakeChan    chan struct{} //// 握手完成后关闭
+	handshakeOnce    sync.Once
+	handshakeErr     error //// 握手失败的原因
+	rejectErr        error //// 本方拒绝对方的原因，应答发送前连接已断开时依然以此作为握手失败的原因
+	handshakeState   int   //// 握手状态
+	handshakeLockObj sync.Mutex
+	helloChan        chan *helloResponse            //// 待发送的握手应答
+	peerHello        *HelloInfo                     //// 对方的握手信息，在handshakeLockObj锁内读写
+	negotiated       atomic.Pointer[negotiatedInfo] //// 握手后确定的连接参数
+
+	inFlightCount    int64 //// 已收到但还没有处理完的请求数量
+	isGoingAway      int32 //// 本方是否即将关闭连接
+	isPeerGoingAway  int32 //// 对方是否即将关闭连接
+	isCloseAfterSend int32 //// 是否在发送完队列中的帧后关闭连接
+
+	attrData       map[string]interface{} //// 连接属性
+	attrLockObj    sync.RWMutex
+	attrChangeFunc func(key string, value interface{}, isExist bool) //// 属性变化时调用，在属性锁内调用
 
 	closeWaitGroup sync.WaitGroup
+	closeCtx       context.Context    //// 连接关闭时取消，作为请求处理上下文的父上下文
+	closeCancel    context.CancelFunc //// 取消closeCtx
 }
 
 // SetRequestExpireMillisecond 设置默认的请求超时时间,
@@ -61,13 +108,65 @@ func (this *RpcConnection) SetRequestExpireMillisecond(requestExpireMillisecond
 	this.requestExpireMillisecond = requestExpireMillisecond
 }
 
+// SetHeaderVersion 设置能使用的最高协议头版本，默认为HeaderVersion_V2
+// 握手时告知对方，发送时使用双方都支持的最高版本；握手完成后修改不再生效
+// 接收时会根据协议头字节自动识别版本
+func (this *RpcConnection) SetHeaderVersion(headerVersion byte) {
+	if this == nil {
+		return
+	}
+
+	this.handshakeLockObj.Lock()
+	defer this.handshakeLockObj.Unlock()
+
+	this.headerVersion = headerVersion
+}
+
+// SetUseMethodId 设置是否使用方法Id代替方法名发送请求
+// 对方在握手信息中告知能识别的方法Id，握手完成前以及对方不能识别的方法依然使用方法名
+func (this *RpcConnection) SetUseMethodId(isUseMethodId bool) {
+	if this == nil {
+		return
+	}
+
+	if isUseMethodId {
+		atomic.StoreInt32(&this.isUseMethodId, Yes)
+	} else {
+		atomic.StoreInt32(&this.isUseMethodId, No)
+	}
+}
+
+// getPeerMethodId 获取对方的方法Id，返回0表示需要使用方法名
+func (this *RpcConnection) getPeerMethodId(methodName string) uint32 {
+	if atomic.LoadInt32(&this.isUseMethodId) == No {
+		return 0
+	}
+
+	// 对方注册的方法名不一致时，说明只是方法Id相同，不能使用方法Id
+	methodId := getMethodId(methodName)
+	if this.getNegotiated().peerMethodIdData[methodId] != methodName {
+		return 0
+	}
+
+	return methodId
+}
+
+// SetErrorDetailLevel 设置错误应答的详细程度
+func (this *RpcConnection) SetErrorDetailLevel(errorDetailLevel ErrorDetailLevel) {
+	if this == nil {
+		return
+	}
+
+	this.errorDetailLevel = errorDetailLevel
+}
+
 func (this *RpcConnection) Call(methodName string, requestObj []interface{}, responseObj []interface{}) (err error) {
 	downChan, err := this.CallAsync(methodName, requestObj, responseObj)
 	if err != nil {
 		return err
 	}
 
-	if this.isClosed != No {
+	if this.IsClosed() {
 		return io.EOF
 	}
 
@@ -79,29 +178,10 @@ func (this *RpcConnection) CallAsync(methodName string, requestObj []interface{}
 		return nil, io.EOF
 	}
 
-	var requestBytes []byte
-	if len(requestObj) > 0 {
-		requestBytes, err = this.getConvertorFunc().MarshalValue(requestObj...)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	if this.isClosed != No {
-		return nil, io.EOF
-	}
-
-	// 添加到等待应答的列表中
-	requestInfoObj := &RequestInfo{
-		RequestId:  this.getRequestId(),
-		DownChan:   make(chan error, 10),
-		ReturnObj:  responseObj,
-		ExpireTime: time.Now().UnixNano()/1000000 + this.requestExpireMillisecond,
+	requestInfoObj, err := this.sendRequest(methodName, requestObj, responseObj, this.getExpireTime(this.requestExpireMillisecond), true)
+	if err != nil {
+		return nil, err
 	}
-	frameObj := newRequestFrame(requestInfoObj, methodName, requestBytes, requestInfoObj.RequestId, true)
-
-	this.frameContainer.AddRequest(requestInfoObj)
-	this.sendChan <- frameObj
 
 	return requestInfoObj.DownChan, nil
 }
@@ -111,49 +191,113 @@ func (this *RpcConnection) CallAsyncWithNoResponse(methodName string, requestObj
 		return io.EOF
 	}
 
-	var requestBytes []byte
-	if len(requestObj) > 0 {
-		requestBytes, err = this.getConvertorFunc().MarshalValue(requestObj...)
-		if err != nil {
-			return err
-		}
+	_, err = this.sendRequest(methodName, requestObj, responseObj, this.getExpireTime(this.requestExpireMillisecond), false)
+
+	return err
+}
+
+func (this *RpcConnection) CallTimeout(methodName string, requestObj []interface{}, responseObj []interface{}, expireMillisecond int64) (err error) {
+	downChan, err := this.CallAsyncTimeout(methodName, requestObj, responseObj, expireMillisecond)
+	if err != nil {
+		return err
 	}
 
-	if this.isClosed != No {
+	if this.IsClosed() {
 		return io.EOF
 	}
 
-	// 添加到等待应答的列表中
-	requestInfoObj := &RequestInfo{
-		RequestId:  this.getRequestId(),
-		DownChan:   make(chan error, 10),
-		ReturnObj:  responseObj,
-		ExpireTime: time.Now().UnixNano()/1000000 + this.requestExpireMillisecond,
+	return <-downChan
+}
+
+func (this *RpcConnection) CallAsyncTimeout(methodName string, requestObj []interface{}, responseObj []interface{}, expireMillisecond int64) (donChan <-chan error, err error) {
+	if this == nil {
+		return nil, io.EOF
 	}
-	frameObj := newRequestFrame(requestInfoObj, methodName, requestBytes, requestInfoObj.RequestId, false)
-	this.sendChan <- frameObj
 
-	return nil
+	requestInfoObj, err := this.sendRequest(methodName, requestObj, responseObj, this.getExpireTime(expireMillisecond), true)
+	if err != nil {
+		return nil, err
+	}
+
+	// 超时后立即移除请求，不依赖发送协程的过期清理；定时器在请求完成时停止
+	timerObj := time.AfterFunc(time.Duration(expireMillisecond)*time.Millisecond, func() {
+		this.frameContainer.RemoveRequestObj(requestInfoObj.RequestId)
+		requestInfoObj.ReturnError(CallTimeoutError)
+	})
+	requestInfoObj.setStopWatchFunc(timerObj.Stop)
+
+	return requestInfoObj.DownChan, nil
 }
 
-func (this *RpcConnection) CallTimeout(methodName string, requestObj []interface{}, responseObj []interface{}, expireMillisecond int64) (err error) {
-	downChan, err := this.CallAsyncTimeout(methodName, requestObj, responseObj, expireMillisecond)
+// CallContext 同步调用，ctx被取消或到期时，立即返回ctx.Err()
+func (this *RpcConnection) CallContext(ctx context.Context, methodName string, requestObj []interface{}, responseObj []interface{}) (err error) {
+	downChan, err := this.CallAsyncContext(ctx, methodName, requestObj, responseObj)
 	if err != nil {
 		return err
 	}
 
-	if this.isClosed != No {
+	if this.IsClosed() {
 		return io.EOF
 	}
 
 	return <-downChan
 }
 
-func (this *RpcConnection) CallAsyncTimeout(methodName string, requestObj []interface{}, responseObj []interface{}, expireMillisecond int64) (donChan <-chan error, err error) {
+// CallAsyncContext 异步调用，ctx被取消或到期时，会从帧容器中移除请求，并通过donChan返回ctx.Err()
+// 如果ctx设置了截止时间，则以截止时间作为请求的过期时间，到期时也可能由过期清理先返回CallTimeoutError
+func (this *RpcConnection) CallAsyncContext(ctx context.Context, methodName string, requestObj []interface{}, responseObj []interface{}) (donChan <-chan error, err error) {
 	if this == nil {
 		return nil, io.EOF
 	}
 
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	expireTime := this.getExpireTime(this.requestExpireMillisecond)
+	if deadline, exist := ctx.Deadline(); exist {
+		expireTime = deadline.UnixNano() / 1000000
+	}
+
+	requestInfoObj, err := this.sendRequest(methodName, requestObj, responseObj, expireTime, true)
+	if err != nil {
+		return nil, err
+	}
+
+	this.watchRequest(ctx, requestInfoObj)
+
+	return requestInfoObj.DownChan, nil
+}
+
+// CallAsyncWithNoResponseContext 不需要应答的调用，如果ctx在帧发送前被取消，则不再发送
+func (this *RpcConnection) CallAsyncWithNoResponseContext(ctx context.Context, methodName string, requestObj []interface{}, responseObj []interface{}) (err error) {
+	if this == nil {
+		return io.EOF
+	}
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	expireTime := this.getExpireTime(this.requestExpireMillisecond)
+	if deadline, exist := ctx.Deadline(); exist {
+		expireTime = deadline.UnixNano() / 1000000
+	}
+
+	requestInfoObj, err := this.sendRequest(methodName, requestObj, responseObj, expireTime, false)
+	if err != nil {
+		return err
+	}
+
+	this.watchRequest(ctx, requestInfoObj)
+
+	return nil
+}
+
+// sendRequest 序列化请求参数，并把请求帧放入发送队列
+// expireTime:过期时间点(单位：毫秒)
+// isNeedResponse:是否需要应答，需要应答的请求会添加到帧容器中等待应答
+func (this *RpcConnection) sendRequest(methodName string, requestObj []interface{}, responseObj []interface{}, expireTime int64, isNeedResponse bool) (requestInfoObj *RequestInfo, err error) {
 	var requestBytes []byte
 	if len(requestObj) > 0 {
 		requestBytes, err = this.getConvertorFunc().MarshalValue(requestObj...)
@@ -162,23 +306,83 @@ func (this *RpcConnection) CallAsyncTimeout(methodName string, requestObj []inte
 		}
 	}
 
-	if this.isClosed != No {
+	return this.sendRequestBytes(context.Background(), methodName, requestBytes, responseObj, expireTime, isNeedResponse)
+}
+
+// sendRequestBytes 把已序列化的请求参数放入发送队列，同一请求发送给多个连接时只需要序列化一次
+// ctx:发送队列已满时最多等待到ctx结束，之后返回SendQueueFullError
+// requestBytes:序列化后的请求参数，发送过程中不会被修改，可以在多个连接间共用
+func (this *RpcConnection) sendRequestBytes(ctx context.Context, methodName string, requestBytes []byte, responseObj []interface{}, expireTime int64, isNeedResponse bool) (requestInfoObj *RequestInfo, err error) {
+	if this.IsClosed() {
 		return nil, io.EOF
 	}
+	if atomic.LoadInt32(&this.isPeerGoingAway) == Yes {
+		return nil, GoingAwayError
+	}
+
+	// 方法名过长时，协议头无法表示，直接返回错误
+	methodId := this.getPeerMethodId(methodName)
+	if methodId == 0 && len(methodName) > int(getMaxMethodNameLen(this.getNegotiated().headerVersion)) {
+		return nil, MethodNameTooLongError
+	}
+
+	requestInfoObj = newRequestInfo(this.getRequestId(), responseObj, expireTime)
+	frameObj := newRequestFrame(requestInfoObj, methodName, requestBytes, requestInfoObj.RequestId, isNeedResponse)
+	frameObj.SetMethodId(methodId)
 
 	// 添加到等待应答的列表中
-	requestInfoObj := &RequestInfo{
-		RequestId:  this.getRequestId(),
-		DownChan:   make(chan error, 10),
-		ReturnObj:  responseObj,
-		ExpireTime: time.Now().UnixNano()/1000000 + expireMillisecond,
+	if isNeedResponse {
+		this.frameContainer.AddRequest(requestInfoObj)
 	}
-	frameObj := newRequestFrame(requestInfoObj, methodName, requestBytes, requestInfoObj.RequestId, true)
+	if err = this.enqueueFrame(ctx, frameObj); err != nil {
+		if isNeedResponse {
+			this.frameContainer.RemoveRequestObj(requestInfoObj.RequestId)
+		}
 
-	this.frameContainer.AddRequest(requestInfoObj)
-	this.sendChan <- frameObj
+		return nil, err
+	}
 
-	return requestInfoObj.DownChan, nil
+	return requestInfoObj, nil
+}
+
+// enqueueFrame 把帧放入发送队列，队列已满时最多等待到ctx结束
+// 返回值:
+// error:ctx结束时返回SendQueueFullError，连接关闭时返回io.EOF
+func (this *RpcConnection) enqueueFrame(ctx context.Context, frameObj *DataFrame) error {
+	// 队列未满时直接放入，避免ctx已结束时随机选择分支导致放入失败
+	select {
+	case this.sendChan <- frameObj:
+		return nil
+	default:
+	}
+
+	select {
+	case this.sendChan <- frameObj:
+		return nil
+	case <-this.closeCtx.Done():
+		return io.EOF
+	case <-ctx.Done():
+		return SendQueueFullError
+	}
+}
+
+// watchRequest 监控请求的上下文，上下文结束时，立即移除请求并返回ctx.Err()
+// 使用context.AfterFunc注册回调，不会为每个请求创建协程，请求完成时取消注册
+func (this *RpcConnection) watchRequest(ctx context.Context, requestInfoObj *RequestInfo) {
+	if ctx.Done() == nil {
+		return
+	}
+
+	stopWatchFunc := context.AfterFunc(ctx, func() {
+		this.frameContainer.RemoveRequestObj(requestInfoObj.RequestId)
+		requestInfoObj.ReturnError(ctx.Err())
+	})
+	requestInfoObj.setStopWatchFunc(stopWatchFunc)
+}
+
+// getExpireTime 获取过期时间点（单位：毫秒）
+func (this *RpcConnection) getExpireTime(expireMillisecond int64) int64 {
+	return time.Now().UnixNano()/1000000 + expireMillisecond
 }
 
 func (this *RpcConnection) getRequestId() uint32 {
@@ -201,6 +405,16 @@ func (this *RpcConnection) close(err error) {
 	// 避免请求处理协程卡住，发一个nil让它流转下
 	this.requestChan <- nil
 
+	// 取消所有正在处理的请求的上下文
+	this.closeCancel()
+
+	// 结束还在进行的握手
+	if err == nil {
+		this.finishHandshake(ConnectionClosedError)
+	} else {
+		this.finishHandshake(err)
+	}
+
 	// 清空所有请求
 	if err == nil {
 		this.frameContainer.ReturnAllRequest(ConnectionClosedError)
@@ -236,21 +450,41 @@ func (this *RpcConnection) receive() {
 		}
 	}()
 
-	var header = make([]byte, HEADER_LENGTH)
+	var header = make([]byte, HEADER_LENGTH_V2)
 	var isHandled bool
-	for this.isClosed == No {
+	for this.IsClosed() == false {
 		// 读取包头
 		err = this.receiveHeader(this.con, header)
-		if this.isClosed == Yes || err != nil {
+		if this.IsClosed() || err != nil {
 			break
 		}
 
 		// 获取帧头
-		frameObj := convertHeader(header, this.byteOrder)
+		frameObj := convertHeader(header, this.getHeaderByteOrder(header[1]))
+		//// 带有校验码时，边读取边计算
+		var reader io.Reader = this.con
+		var hashObj hash.Hash32
+		if frameObj.HasChecksum() {
+			reader, hashObj = this.newChecksumReader(header[:getHeaderLength(header[0])])
+		}
+		//// 读取扩展字段
+		var extend []byte
+		if frameObj.HasExtend() {
+			if extend, err = this.receiveExtend(reader); err != nil {
+				break
+			}
+		}
 		//// 读取包内容
+		if this.isFrameTooLarge(frameObj) {
+			if err = this.handleOversizeFrame(frameObj); err != nil {
+				break
+			}
+
+			continue
+		}
 		if frameObj.MethodNameLen > 0 || frameObj.ContentLength > 0 {
 			buffer := make([]byte, frameObj.ContentLength+uint32(frameObj.MethodNameLen))
-			_, err = io.ReadFull(this.con, buffer)
+			_, err = io.ReadFull(reader, buffer)
 			if err != nil {
 				break
 			}
@@ -258,6 +492,50 @@ func (this *RpcConnection) receive() {
 			frameObj.SetData(buffer)
 		}
 
+		//// 校验失败的帧直接丢弃，协商使用校验码后，不带校验码的帧(如标识位被破坏)也按校验失败处理
+		if hashObj == nil && frameObj.TransformType() != TransformType_Hello && this.getNegotiated().isUseChecksum {
+			this.handleChecksumError(frameObj)
+			continue
+		}
+		if hashObj != nil {
+			var isOk bool
+			if isOk, err = this.receiveChecksum(hashObj); err != nil {
+				break
+			}
+			if isOk == false {
+				this.handleChecksumError(frameObj)
+				continue
+			}
+		}
+		if len(extend) > 0 {
+			if err = frameObj.parseExtend(extend, this.byteOrder); err != nil {
+				break
+			}
+		}
+		//// 解压内容
+		if frameObj.IsCompressed() {
+			if tmpErr := this.decompressFrame(frameObj); tmpErr != nil {
+				if err = this.handleDecompressError(frameObj, tmpErr); err != nil {
+					break
+				}
+
+				continue
+			}
+		}
+
+		// 握手完成前只处理握手帧，握手失败的连接会被关闭，期间收到的帧直接丢弃
+		if frameObj.TransformType() == TransformType_Hello {
+			this.handleHello(frameObj)
+			continue
+		}
+		if this.waitHandshake() != nil {
+			continue
+		}
+		if frameObj.TransformType() == TransformType_GoAway {
+			this.handleGoAway()
+			continue
+		}
+
 		isHandled, err = this.rpcWatcherObj.beforeHandleFrame(frameObj)
 		if isHandled || err != nil {
 			// 已处理，或者出现error，则跳过这个包
@@ -265,7 +543,7 @@ func (this *RpcConnection) receive() {
 		}
 
 		// 是请求帧，但又没有设置请求函数，则代表是非法帧
-		if frameObj.MethodNameLen == 0 && frameObj.ResponseFrameId == 0 {
+		if frameObj.MethodNameLen == 0 && frameObj.MethodId == 0 && frameObj.ResponseFrameId == 0 {
 			log.Warn("receive error frame ip:%v", this.Addr())
 			// 跳过错误的帧
 			continue
@@ -276,36 +554,54 @@ func (this *RpcConnection) receive() {
 	}
 }
 
-func (this *RpcConnection) receiveHeader(con net.Conn, header []byte) error {
-	startIndex := 1
-	for this.isClosed == No {
-		_, err := io.ReadFull(this.con, header[:1])
-		if err != nil {
-			return err
-		}
-		if header[0] != HEADER { //// 找协议头
-			continue
-		}
+// 读取扩展字段(不包含2字节的长度)，校验通过后再解析
+func (this *RpcConnection) receiveExtend(reader io.Reader) ([]byte, error) {
+	lenBytes := make([]byte, 2)
+	if _, err := io.ReadFull(reader, lenBytes); err != nil {
+		return nil, err
+	}
 
-		for this.isClosed == No {
-			_, err = io.ReadFull(this.con, header[startIndex:])
+	extend := make([]byte, this.byteOrder.Uint16(lenBytes))
+	if _, err := io.ReadFull(reader, extend); err != nil {
+		return nil, err
+	}
+
+	return extend, nil
+}
+
+// receiveHeader 读取协议头，同时支持V1和V2协议头
+// header:长度至少为HEADER_LENGTH_V2
+func (this *RpcConnection) receiveHeader(con net.Conn, header []byte) error {
+	startIndex := 0 //// header中已读取的有效字节数
+	for this.IsClosed() == false {
+		if startIndex == 0 {
+			_, err := io.ReadFull(con, header[:1])
 			if err != nil {
 				return err
 			}
-			if header[HEADER_LENGTH-1] == TAIL {
-				// 已解析出了帧头
-				return nil
+			if getHeaderLength(header[0]) == 0 { //// 找协议头
+				continue
 			}
+			startIndex = 1
+		}
 
-			// 在解析到不正确包的情况下，先找到一个合适的包头
-			for i := 1; i < HEADER_LENGTH; i++ {
-				if header[i] == HEADER {
-					tmpHeader := make([]byte, HEADER_LENGTH-i)
-					copy(tmpHeader, header[i:])
-					copy(header, tmpHeader[:HEADER_LENGTH-i])
-					startIndex = i + 1
-					break
-				}
+		headerLength := getHeaderLength(header[0])
+		_, err := io.ReadFull(con, header[startIndex:headerLength])
+		if err != nil {
+			return err
+		}
+		if header[headerLength-1] == TAIL {
+			// 已解析出了帧头
+			return nil
+		}
+
+		// 在解析到不正确包的情况下，从已读取的数据中找到下一个协议头
+		startIndex = 0
+		for i := 1; i < headerLength; i++ {
+			if getHeaderLength(header[i]) > 0 {
+				copy(header, header[i:headerLength])
+				startIndex = headerLength - i
+				break
 			}
 		}
 	}
@@ -321,7 +617,7 @@ func (this *RpcConnection) send() {
 		for {
 			select {
 			case item := <-this.sendChan:
-				if item.RequestObj == nil {
+				if item == nil || item.RequestObj == nil {
 					// 因为心跳没有请求数据，所以此处需要排队
 					continue
 				}
@@ -342,13 +638,40 @@ func (this *RpcConnection) send() {
 		}
 	}()
 
-	for this.isClosed == No {
+	// 先完成握手，再发送其他帧
+	if err = this.handshake(); err != nil {
+		log.Warn("handshake fail ip:%v error:%v", this.Addr(), err)
+		return
+	}
+
+	for this.IsClosed() == false {
 		select {
 		case item := <-this.sendChan:
+			if item == nil {
+				// 之前的帧都已发送，关闭连接
+				err = GoingAwayError
+				return
+			}
+			if item.RequestObj != nil && atomic.LoadInt32(&item.RequestObj.IsResponsed) == Yes {
+				// 请求在发送前已被取消，不再发送
+				continue
+			}
+
+			this.setRequestTimeout(item)
+			this.compressFrame(item)
+			if this.checkSendFrameSize(item) == false {
+				continue
+			}
+
 			if err = this.directlySendFrame(item); err != nil {
 				break
 			}
 
+			if item.RequestObj != nil && item.IsNeedResponse() == false {
+				// 不需要应答的请求，发送后即完成
+				item.RequestObj.Return(nil, nil, nil)
+			}
+
 			// 每次发送数据后调用的接口
 			this.rpcWatcherObj.afterSend(item)
 		default:
@@ -358,7 +681,7 @@ func (this *RpcConnection) send() {
 		}
 
 		// 发送调度处理
-		if err = this.rpcWatcherObj.sendSchedule(); err != nil {
+		if err = this.rpcWatcherObj.sendSchedule(this); err != nil {
 			break
 		}
 
@@ -367,6 +690,19 @@ func (this *RpcConnection) send() {
 	}
 }
 
+// setRequestTimeout 把请求剩余的超时时长告知对方，对方不能识别超时扩展字段时不发送
+func (this *RpcConnection) setRequestTimeout(frameObj *DataFrame) {
+	if frameObj.RequestObj == nil || frameObj.RequestObj.ExpireTime <= 0 || this.getNegotiated().isUseTimeout == false {
+		return
+	}
+
+	timeout := frameObj.RequestObj.ExpireTime - time.Now().UnixNano()/1000000
+	if timeout < 1 {
+		timeout = 1
+	}
+	frameObj.SetTimeout(uint32(timeout))
+}
+
 func (this *RpcConnection) handleFrame(frameObj *DataFrame) {
 	if frameObj.ResponseFrameId != 0 {
 		// 应答处理
@@ -376,18 +712,30 @@ func (this *RpcConnection) handleFrame(frameObj *DataFrame) {
 			return
 		}
 
-		requestObj.ReturnBytes = frameObj.Data
+		// 先抢占应答权，已超时或被取消的请求不再反序列化，避免与调用方同时读写返回值对象
+		if requestObj.claim() == false {
+			return
+		}
+
 		if frameObj.IsError() {
-			requestObj.ReturnError(errors.New(string(frameObj.Data)))
+			requestObj.finish(frameObj.Data, unmarshalError(frameObj.Data))
 		} else if len(requestObj.ReturnObj) > 0 {
 			//// 反序列化参数
 			tmpErr := this.getConvertorFunc().UnMarhsalValue(frameObj.Data, requestObj.ReturnObj...)
-			requestObj.Return(requestObj.ReturnObj, frameObj.Data, tmpErr)
+			requestObj.finish(frameObj.Data, tmpErr)
 		} else {
-			//// 没有返回值
-			requestObj.Return(nil, nil, nil)
+			//// 没有返回值对象，保留原始内容
+			requestObj.finish(frameObj.Data, nil)
 		}
 	} else {
+		// 先计数再检查，确保即将关闭时不会漏掉正在处理的请求
+		atomic.AddInt64(&this.inFlightCount, 1)
+		if atomic.LoadInt32(&this.isGoingAway) == Yes {
+			this.doneRequest()
+			this.response(frameObj, nil, GoingAwayError)
+			return
+		}
+
 		// 使用异步方式来处理请求
 		this.requestChan <- frameObj
 	}
@@ -397,8 +745,9 @@ func (this *RpcConnection) handleFrame(frameObj *DataFrame) {
 
 func (this *RpcConnection) handleRequestFrame() {
 	defer this.closeWaitGroup.Done()
+	defer this.stopDispatcher() //// 退出时停止当前的分发器，处理过程中可能已被替换
 
-	for this.isClosed == No {
+	for this.IsClosed() == false {
 		select {
 		case frameObj := <-this.requestChan:
 			{
@@ -406,39 +755,158 @@ func (this *RpcConnection) handleRequestFrame() {
 					continue
 				}
 
-				// 请求处理
-				methodObj, exist := this.apiMgr.getMethod(frameObj.MethodName())
-				if exist == false {
-					this.response(frameObj, nil, MethodNotFoundError)
-					log.Error("not fount method methodname:%v", frameObj.MethodName())
+				this.dispatchRequest(frameObj)
+			}
+		}
+	}
+}
 
-					continue
-				}
+// dispatchRequest 解析请求后交给分发器处理，分发器没有处理能力时应答ServerBusyError
+func (this *RpcConnection) dispatchRequest(frameObj *DataFrame) {
+	// 请求处理
+	methodObj, exist := this.getMethod(frameObj)
+	if exist == false {
+		this.doneRequest()
+		this.response(frameObj, nil, MethodNotFoundError)
+		log.Error("not fount method methodname:%v methodid:%v", frameObj.MethodName(), frameObj.MethodId)
 
-				// 参数组装
-				convertorObj := this.getConvertorFunc()
-				paramList, err := methodObj.GetInvokeParamList(this.connectionDetail, convertorObj, frameObj.Data)
-				if err != nil {
-					this.response(frameObj, nil, InnerDataError)
-					continue
-				}
+		return
+	}
 
-				// 接口调用
-				responseList, err := methodObj.Invoke(this, paramList)
-				responseList, err = this.rpcWatcherObj.afterInvoke(frameObj, responseList, err) //// 应答处理
-				if err != nil {
-					this.response(frameObj, nil, InnerDataError)
-					continue
-				}
+	// 参数组装
+	ctx, cancel := this.newRequestContext(frameObj)
+	convertorObj := this.getConvertorFunc()
+	paramList, err := methodObj.GetInvokeParamList(ctx, this.connectionDetail, convertorObj, frameObj.Data)
+	if err != nil {
+		cancel()
+		this.doneRequest()
+		this.response(frameObj, nil, err)
+		return
+	}
 
-				// 应答
-				if frameObj.IsNeedResponse() {
-					bytesData, err := methodObj.GetResponseBytes(this, responseList, convertorObj)
-					this.response(frameObj, bytesData, err)
-				}
+	taskFunc := func() {
+		defer this.doneRequest()
+		defer cancel()
+		this.handleRequest(frameObj, methodObj, paramList, convertorObj)
+	}
+
+	var orderKey interface{}
+	if methodObj.executeMode == ExecuteMode_Ordered {
+		if orderKey, err = methodObj.getOrderKey(this.connectionDetail, paramList); err != nil {
+			if panicErr, ok := err.(*PanicError); ok {
+				this.rpcWatcherObj.afterPanic(frameObj, panicErr)
 			}
+
+			cancel()
+			this.doneRequest()
+			this.response(frameObj, nil, err)
+			return
+		}
+	}
+
+	// 串行分发时任务直接在当前协程执行，处理函数中可能会修改分发方式，所以分发时不能持有锁
+	// 分发失败时如果分发方式已被修改(旧的分发器已停止)，则使用新的分发器重试
+	var isOk bool
+	for {
+		dispatcherObj := this.getDispatcher()
+		if methodObj.executeMode == ExecuteMode_Ordered {
+			isOk = this.orderedQueue.dispatch(orderKey, taskFunc, dispatcherObj)
+		} else {
+			isOk = dispatcherObj.dispatch(taskFunc)
+		}
+		if isOk || dispatcherObj == this.getDispatcher() {
+			break
 		}
 	}
+	if isOk == false {
+		cancel()
+		this.doneRequest()
+		log.Warn("server busy methodname:%v ip:%v", methodObj.MethodName, this.Addr())
+		this.response(frameObj, nil, ServerBusyError)
+	}
+}
+
+// getMethod 获取请求的方法，带有方法Id时优先使用方法Id
+// 不修改帧内容，使用方法Id的请求中方法名为空，需要方法名时使用MethodInfo.MethodName
+func (this *RpcConnection) getMethod(frameObj *DataFrame) (*MethodInfo, bool) {
+	if frameObj.MethodId == 0 {
+		return this.apiMgr.getMethod(frameObj.MethodName())
+	}
+
+	return this.apiMgr.getMethodById(frameObj.MethodId)
+}
+
+// handleRequest 调用请求的方法，并进行应答
+func (this *RpcConnection) handleRequest(frameObj *DataFrame, methodObj *MethodInfo, paramList []reflect.Value, convertorObj IByteConvertor) {
+	// 调用方已放弃的请求不再处理
+	if frameObj.ExpireTime > 0 && frameObj.ExpireTime < time.Now().UnixNano()/1000000 {
+		log.Debug("skip expired request methodname:%v ip:%v", methodObj.MethodName, this.Addr())
+		return
+	}
+
+	// 接口调用
+	responseList, err := methodObj.Invoke(this, paramList)
+	if panicErr, ok := err.(*PanicError); ok {
+		this.rpcWatcherObj.afterPanic(frameObj, panicErr)
+	}
+	responseList, err = this.rpcWatcherObj.afterInvoke(frameObj, responseList, err) //// 应答处理
+	if err != nil {
+		this.response(frameObj, nil, err)
+		return
+	}
+
+	// 应答
+	if frameObj.IsNeedResponse() {
+		bytesData, err := methodObj.GetResponseBytes(this, responseList, convertorObj)
+		this.response(frameObj, bytesData, err)
+	}
+}
+
+// SetDispatchConfig 设置请求分发方式，可以在连接处理过程中修改
+// 修改后，已分发的请求会继续处理完
+func (this *RpcConnection) SetDispatchConfig(config DispatchConfig) {
+	if this == nil {
+		return
+	}
+
+	dispatcherObj := newRequestDispatcher(config)
+
+	this.dispatcherLockObj.Lock()
+	defer this.dispatcherLockObj.Unlock()
+
+	this.dispatcher.stop()
+	this.dispatcher = dispatcherObj
+
+	// 请求处理已结束，新的分发器不会再被使用
+	if this.isDispatcherStopped {
+		dispatcherObj.stop()
+	}
+}
+
+// getDispatcher 获取当前的请求分发器
+func (this *RpcConnection) getDispatcher() requestDispatcher {
+	this.dispatcherLockObj.RLock()
+	defer this.dispatcherLockObj.RUnlock()
+
+	return this.dispatcher
+}
+
+// stopDispatcher 请求处理结束时停止分发器，之后设置的分发器也会立即停止
+func (this *RpcConnection) stopDispatcher() {
+	this.dispatcherLockObj.Lock()
+	defer this.dispatcherLockObj.Unlock()
+
+	this.isDispatcherStopped = true
+	this.dispatcher.stop()
+}
+
+// newRequestContext 创建请求处理用的上下文，连接关闭时会被取消，并带有调用方的截止时间
+func (this *RpcConnection) newRequestContext(frameObj *DataFrame) (context.Context, context.CancelFunc) {
+	if frameObj.ExpireTime > 0 {
+		return context.WithDeadline(this.closeCtx, time.Unix(0, frameObj.ExpireTime*int64(time.Millisecond)))
+	}
+
+	return context.WithCancel(this.closeCtx)
 }
 
 func (this *RpcConnection) response(frameObj *DataFrame, returnBytes []byte, err error) {
@@ -446,12 +914,16 @@ func (this *RpcConnection) response(frameObj *DataFrame, returnBytes []byte, err
 		// 不需要应答则不处理
 		return
 	}
+	if this.IsClosed() {
+		// 连接已关闭，无法应答
+		return
+	}
 
 	// 应答
 	responseFrame := newResponseFrame(frameObj, returnBytes, this.getRequestId())
 	if err != nil {
 		// 应答错误处理
-		responseFrame.SetError(err.Error())
+		responseFrame.SetError(string(marshalError(err, this.errorDetailLevel)))
 	}
 	this.sendChan <- responseFrame
 }
@@ -461,7 +933,7 @@ func (this *RpcConnection) Conn() net.Conn {
 }
 
 func (this *RpcConnection) IsClosed() bool {
-	return this.isClosed == Yes
+	return atomic.LoadInt32(&this.isClosed) == Yes
 }
 
 func (this *RpcConnection) ConnectionId() int64 {
@@ -487,12 +959,24 @@ func (this *RpcConnection) directlySendFrame(frameObj *DataFrame) error {
 		return fmt.Errorf("have no connection")
 	}
 
-	_, err := conObj.Write(frameObj.GetHeader(this.byteOrder))
+	extendBytes := frameObj.buildExtend(this.byteOrder)
+	// 握手帧不带校验码，因为此时还不确定对方的字节序
+	frameObj.SetChecksum(this.getNegotiated().isUseChecksum && frameObj.TransformType() != TransformType_Hello)
+	headerBytes := frameObj.GetHeader(this.getHeaderByteOrder(frameObj.Flag))
+	_, err := conObj.Write(headerBytes)
 	if err != nil {
 		log.Debug("write to connection error:%v", err.Error())
 		return err
 	}
 
+	if len(extendBytes) > 0 {
+		_, err = conObj.Write(extendBytes)
+		if err != nil {
+			log.Debug("write to connection error:%v", err.Error())
+			return err
+		}
+	}
+
 	if frameObj.MethodNameLen > 0 {
 		_, err = conObj.Write(frameObj.MethodNameBytes)
 		if err != nil {
@@ -511,9 +995,23 @@ func (this *RpcConnection) directlySendFrame(frameObj *DataFrame) error {
 		}
 	}
 
+	if frameObj.HasChecksum() {
+		var methodNameBytes []byte
+		if frameObj.MethodNameLen > 0 {
+			methodNameBytes = frameObj.MethodNameBytes
+		}
+
+		_, err = conObj.Write(this.getChecksumBytes(headerBytes, extendBytes, methodNameBytes, frameObj.Data[:frameObj.ContentLength]))
+		if err != nil {
+			log.Debug("write to connection error:%v", err.Error())
+			return err
+		}
+	}
+
 	return nil
 }
 
+// newRpcConnection 创建连接对象，设置完连接参数后需要调用start开始处理
 func newRpcConnection(apiMgr *ApiMgr, con net.Conn, watcherObj RpcWatcher, connectionDetail RpcConnectioner, order binary.ByteOrder, getConvertorFunc func() IByteConvertor) *RpcConnection {
 	var result = &RpcConnection{
 		apiMgr:                   apiMgr,
@@ -529,14 +1027,25 @@ func newRpcConnection(apiMgr *ApiMgr, con net.Conn, watcherObj RpcWatcher, conne
 		byteOrder:                order,
 		connectionDetail:         connectionDetail,
 		getConvertorFunc:         getConvertorFunc,
+		headerVersion:            HeaderVersion_V2,
+		maxFrameSize:             DefaultMaxFrameSize,
+		dispatcher:               new(serialDispatcher),
+		orderedQueue:             newOrderedQueue(),
+		handshakeChan:            make(chan struct{}),
+		helloChan:                make(chan *helloResponse, 1),
 	}
 
-	result.closeWaitGroup.Add(3)
-
-	// 开协程进行具体处理
-	go result.receive()
-	go result.send()
-	go result.handleRequestFrame()
+	result.closeCtx, result.closeCancel = context.WithCancel(context.Background())
 
 	return result
 }
+
+// start 开始处理连接，需要在设置完连接参数后调用，连接建立后会先进行握手
+func (this *RpcConnection) start() {
+	this.closeWaitGroup.Add(3)
+
+	// 开协程进行具体处理
+	go this.receive()
+	go this.send()
+	go this.handleRequestFrame()
+}
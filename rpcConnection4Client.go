@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"reflect"
+	"sync/atomic"
 	"time"
 
 	"github.com/polariseye/rpc-go/log"
@@ -14,7 +15,8 @@ type RpcConnection4Client struct {
 	keepAliveInterval    int64 //// 单位：秒 默认5秒
 	preSendKeepAliveTime int64
 
-	connectionedHandlerData map[string]func(connObj RpcConnectioner)
+	connectionedHandlerData    map[string]func(connObj RpcConnectioner)
+	handshakeResultHandlerData map[string]func(connObj RpcConnectioner, err error)
 }
 
 func (this *RpcConnection4Client) afterSend(frameObj *DataFrame) (err error) {
@@ -22,18 +24,18 @@ func (this *RpcConnection4Client) afterSend(frameObj *DataFrame) (err error) {
 	return nil
 }
 
-func (this *RpcConnection4Client) sendSchedule() (err error) {
+// sendSchedule 发送心跳，重连时旧连接的发送协程可能还未退出，所以使用调用方传入的连接
+func (this *RpcConnection4Client) sendSchedule(connObj *RpcConnection) (err error) {
 	now := time.Now().Unix()
-	connObj := this.RpcConnection
 
 	// 心跳发送
-	if connObj != nil && (now-this.preSendKeepAliveTime) > this.keepAliveInterval {
+	if connObj != nil && (now-atomic.LoadInt64(&this.preSendKeepAliveTime)) > this.keepAliveInterval {
 		frameObj := newRequestFrame(nil, "", nil, connObj.getRequestId(), true)
 		frameObj.SetTransformType(TransformType_KeepAlive)
 
-		this.directlySendFrame(frameObj)
+		connObj.directlySendFrame(frameObj)
 		//// 此处不管是否报错，都需要加心跳，以避免一直发不停心跳
-		this.preSendKeepAliveTime = now
+		atomic.StoreInt64(&this.preSendKeepAliveTime, now)
 	}
 
 	this.invokeSendScheduleHandler(this)
@@ -58,11 +60,36 @@ func (this *RpcConnection4Client) afterInvoke(frameObj *DataFrame, returnList []
 func (this *RpcConnection4Client) afterClose() {
 	this.invokeCloseHandler(this)
 }
+
+func (this *RpcConnection4Client) afterPanic(frameObj *DataFrame, panicErr *PanicError) {
+	this.invokePanicHandler(this, frameObj, panicErr)
+}
+
+func (this *RpcConnection4Client) checkHandshake(peerHello *HelloInfo) (err error) {
+	return this.invokeHandshakeHandler(this, peerHello)
+}
+
+func (this *RpcConnection4Client) afterOversizeFrame(frameObj *DataFrame) {
+	this.invokeOversizeFrameHandler(this, frameObj)
+}
+
+func (this *RpcConnection4Client) afterChecksumError(frameObj *DataFrame) {
+	this.invokeChecksumErrorHandler(this, frameObj)
+}
+
 func (this *RpcConnection4Client) setConnection(con *RpcConnection) {
 	this.RpcConnection = con
+}
 
-	// 触发连接事件
-	this.invokeConnectedHandler(con)
+// waitConnected 等待握手完成，并触发握手结果事件，握手成功时触发连接事件
+func (this *RpcConnection4Client) waitConnected(con *RpcConnection) error {
+	err := con.waitHandshake()
+	this.invokeHandshakeResultHandler(con, err)
+	if err == nil {
+		this.invokeConnectedHandler(con)
+	}
+
+	return err
 }
 
 func (this *RpcConnection4Client) IsClosed() bool {
@@ -73,6 +100,7 @@ func (this *RpcConnection4Client) IsClosed() bool {
 	return this.RpcConnection.IsClosed()
 }
 
+// AddConnectedHandler 添加连接事件，握手成功后触发
 func (this *RpcConnection4Client) AddConnectedHandler(funcName string, funcObj func(connObj RpcConnectioner)) (err error) {
 	if _, exist := this.connectionedHandlerData[funcName]; exist {
 		return HandlerExistedError
@@ -88,11 +116,29 @@ func (this *RpcConnection4Client) invokeConnectedHandler(connObj RpcConnectioner
 	}
 }
 
+// AddHandshakeResultHandler 添加握手结果事件，握手成功或失败都会触发
+// err:握手失败的原因，如字节序或转换器与对方不一致、被对方拒绝，为nil表示握手成功
+func (this *RpcConnection4Client) AddHandshakeResultHandler(funcName string, funcObj func(connObj RpcConnectioner, err error)) (err error) {
+	if _, exist := this.handshakeResultHandlerData[funcName]; exist {
+		return HandlerExistedError
+	}
+
+	this.handshakeResultHandlerData[funcName] = funcObj
+	return nil
+}
+
+func (this *RpcConnection4Client) invokeHandshakeResultHandler(connObj RpcConnectioner, err error) {
+	for _, item := range this.handshakeResultHandlerData {
+		item(connObj, err)
+	}
+}
+
 func NewRpcConnection4Client() *RpcConnection4Client {
 	result := &RpcConnection4Client{
-		RpcWatchBase:            newRpcWatchBase(),
-		keepAliveInterval:       5,
-		connectionedHandlerData: make(map[string]func(connObj RpcConnectioner), 4),
+		RpcWatchBase:               newRpcWatchBase(),
+		keepAliveInterval:          5,
+		connectionedHandlerData:    make(map[string]func(connObj RpcConnectioner), 4),
+		handshakeResultHandlerData: make(map[string]func(connObj RpcConnectioner, err error), 4),
 	}
 
 	return result
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"net"
 	"reflect"
+	"sync/atomic"
 	"time"
 
 	"github.com/polariseye/rpc-go/log"
@@ -28,11 +29,11 @@ func (this *RpcConnection4Server) afterSend(frameObj *DataFrame) (err error) {
 	return nil
 }
 
-func (this *RpcConnection4Server) sendSchedule() (err error) {
+func (this *RpcConnection4Server) sendSchedule(connObj *RpcConnection) (err error) {
 	now := time.Now().Unix()
 
 	// 检查心跳时间
-	if (now - this.preReceiveKeepAliveTime) > this.connectionTimeoutSecond {
+	if (now - atomic.LoadInt64(&this.preReceiveKeepAliveTime)) > this.connectionTimeoutSecond {
 		// 心跳超时处理
 		log.Debug("Connection Timeout IP:%v", this.Addr())
 		this.close(ConnectionTimeOut)
@@ -56,7 +57,7 @@ func (this *RpcConnection4Server) beforeHandleFrame(frameObj *DataFrame) (isHand
 			//log.Debug("receive KeepAlive Response IP:%v", this.Addr())
 		}
 		// 更新上次心跳时间
-		this.preReceiveKeepAliveTime = time.Now().Unix()
+		atomic.StoreInt64(&this.preReceiveKeepAliveTime, time.Now().Unix())
 
 		isHandled = true
 
@@ -86,7 +87,31 @@ func (this *RpcConnection4Server) afterClose() {
 	this.invokeCloseHandler(this)
 }
 
+func (this *RpcConnection4Server) afterPanic(frameObj *DataFrame, panicErr *PanicError) {
+	this.invokePanicHandler(this, frameObj, panicErr)
+}
+
+func (this *RpcConnection4Server) checkHandshake(peerHello *HelloInfo) (err error) {
+	return this.invokeHandshakeHandler(this, peerHello)
+}
+
+func (this *RpcConnection4Server) afterOversizeFrame(frameObj *DataFrame) {
+	this.invokeOversizeFrameHandler(this, frameObj)
+}
+
+func (this *RpcConnection4Server) afterChecksumError(frameObj *DataFrame) {
+	this.invokeChecksumErrorHandler(this, frameObj)
+}
+
 func NewRpcConnection4Server(con net.Conn, apiMgr *ApiMgr, order binary.ByteOrder, getConvertorFunc func() IByteConvertor) *RpcConnection4Server {
+	result := newRpcConnection4Server(con, apiMgr, order, getConvertorFunc)
+	result.start()
+
+	return result
+}
+
+// newRpcConnection4Server 创建连接对象，设置完连接参数后需要调用start开始处理
+func newRpcConnection4Server(con net.Conn, apiMgr *ApiMgr, order binary.ByteOrder, getConvertorFunc func() IByteConvertor) *RpcConnection4Server {
 	result := &RpcConnection4Server{
 		RpcWatchBase:            newRpcWatchBase(),
 		connectionTimeoutSecond: 20,
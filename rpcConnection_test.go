@@ -0,0 +1,186 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestConnectionPair 使用内存连接创建服务端连接和客户端，并完成握手
+func newTestConnectionPair(t *testing.T, apiMgr *ApiMgr) (*RpcConnection4Server, *RpcClient) {
+	clientCon, serverCon := net.Pipe()
+	serverObj := NewRpcConnection4Server(serverCon, apiMgr, binary.LittleEndian, GetJsonConvertor)
+
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	if err := clientObj.Start2(clientCon); err != nil {
+		serverObj.Close()
+		t.Fatalf("start error:%v", err)
+	}
+
+	return serverObj, clientObj
+}
+
+func TestRequestTimeout(t *testing.T) {
+	var countValue int32
+	ctxErrChan := make(chan error, 1)
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Wait", func(connObj RpcConnectioner, ctx context.Context) {
+		<-ctx.Done()
+		ctxErrChan <- ctx.Err()
+
+		// 服务端的截止时间按毫秒取整，可能比调用方稍早，延后应答以免先于调用方超时到达
+		time.Sleep(50 * time.Millisecond)
+	})
+	apiMgr.RegisterFunc("Sample", "Sleep", func(connObj RpcConnectioner) {
+		time.Sleep(300 * time.Millisecond)
+	})
+	apiMgr.RegisterFunc("Sample", "Count", func(connObj RpcConnectioner) {
+		atomic.AddInt32(&countValue, 1)
+	})
+
+	serverObj, clientObj := newTestConnectionPair(t, apiMgr)
+	defer serverObj.Close()
+	defer clientObj.Close()
+
+	// 处理函数通过上下文得知调用方的截止时间
+	if err := clientObj.CallTimeout("Sample_Wait", nil, nil, 100); err != CallTimeoutError {
+		t.Errorf("expect CallTimeoutError but got:%v", err)
+	}
+	select {
+	case err := <-ctxErrChan:
+		if err != context.DeadlineExceeded {
+			t.Errorf("handler context error:%v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("handler context not done")
+	}
+
+	// 串行处理时，排队期间过期的请求不再执行
+	doneChan, err := clientObj.CallAsync("Sample_Sleep", nil, nil)
+	if err != nil {
+		t.Errorf("call error:%v", err)
+		return
+	}
+	if err = clientObj.CallTimeout("Sample_Count", nil, nil, 100); err != CallTimeoutError {
+		t.Errorf("expect CallTimeoutError but got:%v", err)
+	}
+	<-doneChan
+	if err = clientObj.Call("Sample_Count", nil, nil); err != nil {
+		t.Errorf("call error:%v", err)
+	}
+	if count := atomic.LoadInt32(&countValue); count != 1 {
+		t.Errorf("expired request should be skipped count:%v", count)
+	}
+}
+
+func TestRequestTimeoutNegotiate(t *testing.T) {
+	// 对方不能识别超时扩展字段时不发送
+	for _, isUseTimeout := range []bool{false, true} {
+		connObj := &RpcConnection{}
+		connObj.negotiated.Store(&negotiatedInfo{isUseTimeout: isUseTimeout})
+
+		frameObj := newRequestFrame(newRequestInfo(1, nil, connObj.getExpireTime(1000)), "Sample_Tst", nil, 1, true)
+		connObj.setRequestTimeout(frameObj)
+		if (frameObj.Timeout > 0) != isUseTimeout {
+			t.Errorf("isUseTimeout:%v timeout:%v", isUseTimeout, frameObj.Timeout)
+		}
+	}
+}
+
+func TestCallContext(t *testing.T) {
+	var countValue int32
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Sleep", func(connObj RpcConnectioner, millisecond int) string {
+		time.Sleep(time.Duration(millisecond) * time.Millisecond)
+		return "late"
+	})
+	apiMgr.RegisterFunc("Sample", "Count", func(connObj RpcConnectioner) {
+		atomic.AddInt32(&countValue, 1)
+	})
+
+	serverObj, clientObj := newTestConnectionPair(t, apiMgr)
+	defer serverObj.Close()
+	defer clientObj.Close()
+
+	// 到期后立即返回（过期清理可能先返回CallTimeoutError），迟到的应答不会写入返回值对象
+	var value string
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	err := clientObj.CallContext(ctx, "Sample_Sleep", []interface{}{200}, []interface{}{&value})
+	cancel()
+	if err != context.DeadlineExceeded && err != CallTimeoutError {
+		t.Errorf("expect DeadlineExceeded but got:%v", err)
+	}
+
+	// 取消后立即返回
+	ctx, cancel = context.WithCancel(context.Background())
+	downChan, err := clientObj.CallAsyncContext(ctx, "Sample_Sleep", []interface{}{200}, []interface{}{&value})
+	if err != nil {
+		t.Errorf("call error:%v", err)
+		cancel()
+		return
+	}
+	cancel()
+	select {
+	case err = <-downChan:
+		if err != context.Canceled {
+			t.Errorf("expect Canceled but got:%v", err)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("cancel not return immediately")
+	}
+
+	// 串行处理，后一个调用返回时迟到的应答都已到达，返回值对象依然未被修改
+	var value2 string
+	if err = clientObj.CallContext(context.Background(), "Sample_Sleep", []interface{}{1}, []interface{}{&value2}); err != nil || value2 != "late" {
+		t.Errorf("call error:%v value:%v", err, value2)
+	}
+	if value != "" {
+		t.Errorf("late response should be dropped value:%v", value)
+	}
+
+	// 已取消的上下文不再发送
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err = clientObj.CallAsyncWithNoResponseContext(ctx, "Sample_Count", nil, nil); err != context.Canceled {
+		t.Errorf("expect Canceled but got:%v", err)
+	}
+	if err = clientObj.CallAsyncWithNoResponseContext(context.Background(), "Sample_Count", nil, nil); err != nil {
+		t.Errorf("call error:%v", err)
+	}
+	for i := 0; i < 100 && atomic.LoadInt32(&countValue) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if count := atomic.LoadInt32(&countValue); count != 1 {
+		t.Errorf("no response call count:%v", count)
+	}
+}
+
+func TestCallTimeoutLateResponse(t *testing.T) {
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Sleep", func(connObj RpcConnectioner, millisecond int) string {
+		time.Sleep(time.Duration(millisecond) * time.Millisecond)
+		return "late"
+	})
+
+	serverObj, clientObj := newTestConnectionPair(t, apiMgr)
+	defer serverObj.Close()
+	defer clientObj.Close()
+
+	var value string
+	if err := clientObj.CallTimeout("Sample_Sleep", []interface{}{100}, []interface{}{&value}, 30); err != CallTimeoutError {
+		t.Errorf("expect CallTimeoutError but got:%v", err)
+	}
+
+	// 串行处理，后一个调用返回时迟到的应答已被处理
+	var value2 string
+	if err := clientObj.Call("Sample_Sleep", []interface{}{1}, []interface{}{&value2}); err != nil || value2 != "late" {
+		t.Errorf("call error:%v value:%v", err, value2)
+	}
+	if value != "" {
+		t.Errorf("late response should be dropped value:%v", value)
+	}
+}
@@ -1,10 +1,12 @@
 package rpc
 
 import (
+	"crypto/tls"
 	"encoding/binary"
 	"net"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/polariseye/rpc-go/log"
 )
@@ -21,6 +23,55 @@ type RpcServer struct {
 	// 心跳超时时间：单位：秒 默认20秒
 	connectionTimeoutSecond  int64
 	newConnectionHandlerData map[string]func(connObj RpcConnectioner) error
+
+	// 握手结果事件，握手失败的连接不会触发新连接事件
+	handshakeResultHandlerData map[string]func(connObj RpcConnectioner, err error)
+
+	// 新连接使用的请求分发配置
+	dispatchConfig DispatchConfig
+
+	// 错误应答的详细程度
+	errorDetailLevel ErrorDetailLevel
+
+	// 新连接发送时可以使用的最高协议头版本
+	headerVersion byte
+
+	// 新连接是否使用方法Id代替方法名发送请求
+	isUseMethodId bool
+
+	// 新连接能接收的最大帧长度，以及收到超长帧时的处理方式
+	maxFrameSize    uint32
+	frameSizeAction FrameSizeAction
+
+	// 新连接是否需要校验码
+	isChecksum bool
+
+	// 新连接的压缩配置
+	compressionConfig CompressionConfig
+
+	// 接收连接出错时的处理
+	acceptErrorHandlerData map[string]func(listener net.Listener, err error, retryDelay time.Duration)
+
+	// 连接准入配置，以及已接收的连接数
+	admissionConfig        AdmissionConfig
+	admittedCount          int
+	ipConnectionCountData  map[string]int //// key:IP
+	newConnectionLimiter   *rateLimiter
+	admissionLockObj       sync.Mutex
+	refusedConnectionCount int64
+	refusingCount          int32 //// 正在发送拒绝原因的连接数
+	refuseHandlerData      map[string]func(con net.Conn, err error)
+
+	// 连接属性索引
+	attrIndexObj *attrIndex
+
+	// 正在监听的对象，关闭时停止监听
+	listenerData    map[net.Listener]struct{}
+	listenerLockObj sync.Mutex
+
+	// 开始关闭时关闭
+	shutdownChan chan struct{}
+	shutdownOnce sync.Once
 }
 
 func (this *RpcServer) GetConnection(connectionId int64) (result *RpcConnection4Server, exist bool) {
@@ -31,11 +82,18 @@ func (this *RpcServer) GetConnection(connectionId int64) (result *RpcConnection4
 	return
 }
 
-func (this *RpcServer) invokeNewConnectionHandler(connObj *RpcConnection4Server) {
+// bindConnectionHandler 把连接的事件关联到服务端，需要在连接开始处理前调用
+func (this *RpcServer) bindConnectionHandler(connObj *RpcConnection4Server) {
+	connObj.attrChangeFunc = func(key string, value interface{}, isExist bool) {
+		this.attrIndexObj.update(connObj, key, value, isExist)
+	}
+
 	// 进行事件关联
 	connObj.AddCloseHandler("RpcServer.CloseHandler", func(connObj RpcConnectioner) {
 		// 添加到连接集合中
 		this.onConnectionClose(connObj.(*RpcConnection4Server))
+		this.release(connObj.Conn())
+		this.attrIndexObj.remove(connObj.ConnectionId())
 
 		this.invokeCloseHandler(connObj)
 	})
@@ -51,7 +109,40 @@ func (this *RpcServer) invokeNewConnectionHandler(connObj *RpcConnection4Server)
 	connObj.AddAfterInvokeHandler("RpcServer.AfterInvokeHandler", func(connObj RpcConnectioner, frameObj *DataFrame, returnList []reflect.Value, err error) (resultReturnList []reflect.Value, resultErr error) {
 		return this.invokeAfterInvokeHandler(connObj, frameObj, returnList, err)
 	})
+	connObj.AddPanicHandler("RpcServer.PanicHandler", func(connObj RpcConnectioner, frameObj *DataFrame, panicErr *PanicError) {
+		this.invokePanicHandler(connObj, frameObj, panicErr)
+	})
+	connObj.AddHandshakeHandler("RpcServer.HandshakeHandler", func(connObj RpcConnectioner, peerHello *HelloInfo) error {
+		return this.invokeHandshakeHandler(connObj, peerHello)
+	})
+	connObj.AddOversizeFrameHandler("RpcServer.OversizeFrameHandler", func(connObj RpcConnectioner, frameObj *DataFrame) {
+		this.invokeOversizeFrameHandler(connObj, frameObj)
+	})
+	connObj.AddChecksumErrorHandler("RpcServer.ChecksumErrorHandler", func(connObj RpcConnectioner, frameObj *DataFrame) {
+		this.invokeChecksumErrorHandler(connObj, frameObj)
+	})
+}
+
+// handleNewConnection 等待新连接握手完成，握手成功后才触发新连接事件
+func (this *RpcServer) handleNewConnection(connObj *RpcConnection4Server) {
+	select {
+	case <-connObj.handshakeChan:
+	case <-this.shutdownChan:
+		// 服务端已关闭，不再等待握手
+		connObj.close(GoingAwayError)
+		return
+	}
+	err := connObj.waitHandshake()
+	this.invokeHandshakeResultHandler(connObj, err)
+	if err != nil {
+		log.Warn("handshake fail ip:%v error:%v", connObj.Addr(), err.Error())
+		return
+	}
 
+	this.invokeNewConnectionHandler(connObj)
+}
+
+func (this *RpcServer) invokeNewConnectionHandler(connObj *RpcConnection4Server) {
 	// 触发新连接的事件
 	for handlerName, item := range this.newConnectionHandlerData {
 		err := item(connObj)
@@ -73,13 +164,21 @@ func (this *RpcServer) invokeNewConnectionHandler(connObj *RpcConnection4Server)
 		}
 	}
 
-	// 添加到连接集合中
-	func() {
+	// 添加到连接集合中，服务端已关闭则直接关闭连接
+	isShutdown := func() bool {
 		this.connDataLockObj.Lock()
 		defer this.connDataLockObj.Unlock()
 
+		if this.isShutdown() {
+			return true
+		}
+
 		this.connData[connObj.ConnectionId()] = connObj
+		return false
 	}()
+	if isShutdown {
+		connObj.close(GoingAwayError)
+	}
 }
 
 func (this *RpcServer) AddNewConnectionHandler(funcName string, funcObj func(connObj RpcConnectioner) error) (err error) {
@@ -91,6 +190,23 @@ func (this *RpcServer) AddNewConnectionHandler(funcName string, funcObj func(con
 	return nil
 }
 
+// AddHandshakeResultHandler 添加握手结果事件，握手成功或失败都会触发，成功时在新连接事件之前触发
+// err:握手失败的原因，如字节序或转换器与对方不一致、被对方拒绝、握手超时，为nil表示握手成功
+func (this *RpcServer) AddHandshakeResultHandler(funcName string, funcObj func(connObj RpcConnectioner, err error)) (err error) {
+	if _, exist := this.handshakeResultHandlerData[funcName]; exist {
+		return HandlerExistedError
+	}
+
+	this.handshakeResultHandlerData[funcName] = funcObj
+	return nil
+}
+
+func (this *RpcServer) invokeHandshakeResultHandler(connObj RpcConnectioner, err error) {
+	for _, item := range this.handshakeResultHandlerData {
+		item(connObj, err)
+	}
+}
+
 func (this *RpcServer) onConnectionClose(connObj *RpcConnection4Server) {
 	this.connDataLockObj.Lock()
 	defer this.connDataLockObj.Unlock()
@@ -99,34 +215,104 @@ func (this *RpcServer) onConnectionClose(connObj *RpcConnection4Server) {
 }
 
 func (this *RpcServer) GetConnectionCount() int {
+	this.connDataLockObj.RLock()
+	defer this.connDataLockObj.RUnlock()
+
 	return len(this.connData)
 }
 
+// Start 监听指定地址，直到监听结束
+// addr:监听地址，支持tcp://、unix://、unix-abstract://、mem://格式，没有指定格式时使用tcp
+// 返回值:
+// error:结束监听的原因，通过Shutdown或Close关闭时返回ServerClosedError
 func (this *RpcServer) Start(addr string) error {
-	listener, err := net.Listen("tcp", addr)
+	listener, err := listen(addr)
 	if err != nil {
 		log.Error("listen error Addr:%v error:%v", addr, err.Error())
 		return err
 	}
 
-	this.Start2(listener)
-	return nil
+	return this.Start2(listener)
 }
 
-func (this *RpcServer) Start2(listener net.Listener) {
+// Start2 使用指定的监听对象处理连接，直到监听关闭或服务端关闭
+// 监听关闭(net.ErrClosed)以外的错误(如文件句柄用完)会等待后重试，重试间隔从5毫秒开始翻倍，最长1秒
+// 返回值:
+// error:结束监听的原因，通过Shutdown或Close关闭时返回ServerClosedError
+func (this *RpcServer) Start2(listener net.Listener) error {
 	defer log.Info("listen over Addr:%v", listener.Addr())
 
+	if this.addListener(listener) == false {
+		// 服务端已关闭
+		listener.Close()
+		return ServerClosedError
+	}
+	defer this.removeListener(listener)
+
+	var retryDelay time.Duration
 	for {
 		con, err := listener.Accept()
 		if err != nil {
-			log.Error("Accept Error Addr:%v error:%v", listener.Addr(), err.Error())
-			return
+			if err = this.handleAcceptError(listener, err, &retryDelay); err != nil {
+				return err
+			}
+
+			continue
+		}
+		retryDelay = 0
+
+		if err = this.admit(con); err != nil {
+			this.refuseConnection(con, err)
+			continue
+		}
+
+		// TLS握手需要与对方交互，不能阻塞接收连接
+		if tlsCon, ok := con.(*tls.Conn); ok {
+			go this.handshakeTLS(tlsCon)
+			continue
 		}
 
-		rpcConnObj := NewRpcConnection4Server(con, this.ApiMgr, this.byteOrder, this.getConvertorFunc)
-		rpcConnObj.SetConnectionTimeoutSecond(this.connectionTimeoutSecond)
-		this.invokeNewConnectionHandler(rpcConnObj)
+		this.serveConnection(con)
+	}
+}
+
+// serveConnection 使用服务端的配置创建连接对象并开始处理
+func (this *RpcServer) serveConnection(con net.Conn) {
+	rpcConnObj := newRpcConnection4Server(con, this.ApiMgr, this.byteOrder, this.getConvertorFunc)
+	rpcConnObj.SetConnectionTimeoutSecond(this.connectionTimeoutSecond)
+	rpcConnObj.SetDispatchConfig(this.dispatchConfig)
+	rpcConnObj.SetErrorDetailLevel(this.errorDetailLevel)
+	rpcConnObj.SetHeaderVersion(this.headerVersion)
+	rpcConnObj.SetMaxFrameSize(this.maxFrameSize, this.frameSizeAction)
+	rpcConnObj.SetChecksum(this.isChecksum)
+	rpcConnObj.SetCompression(this.compressionConfig)
+	if this.isUseMethodId {
+		rpcConnObj.SetUseMethodId(true)
 	}
+	this.bindConnectionHandler(rpcConnObj)
+	rpcConnObj.start()
+
+	go this.handleNewConnection(rpcConnObj)
+}
+
+// addListener 添加正在监听的对象，服务端已关闭则返回false
+func (this *RpcServer) addListener(listener net.Listener) bool {
+	this.listenerLockObj.Lock()
+	defer this.listenerLockObj.Unlock()
+
+	if this.isShutdown() {
+		return false
+	}
+
+	this.listenerData[listener] = struct{}{}
+	return true
+}
+
+func (this *RpcServer) removeListener(listener net.Listener) {
+	this.listenerLockObj.Lock()
+	defer this.listenerLockObj.Unlock()
+
+	delete(this.listenerData, listener)
 }
 
 // SetConnectionTimeoutSecond 设置连接超时时间（多久没有收到心跳就断开连接）
@@ -134,15 +320,67 @@ func (this *RpcServer) SetConnectionTimeoutSecond(connectionTimeoutSecond int64)
 	this.connectionTimeoutSecond = connectionTimeoutSecond
 }
 
+// SetDispatchConfig 设置新连接的请求分发方式，已建立的连接不受影响
+// 单个连接可以通过RpcConnectioner.SetDispatchConfig单独设置
+func (this *RpcServer) SetDispatchConfig(config DispatchConfig) {
+	this.dispatchConfig = config
+}
+
+// SetErrorDetailLevel 设置新连接的错误应答详细程度
+// 正式环境建议使用ErrorDetailLevel_Simple以隐藏内部细节，开发环境可以使用ErrorDetailLevel_Full
+func (this *RpcServer) SetErrorDetailLevel(errorDetailLevel ErrorDetailLevel) {
+	this.errorDetailLevel = errorDetailLevel
+}
+
+// SetHeaderVersion 设置新连接能使用的最高协议头版本，默认为HeaderVersion_V2
+// 握手时与对方协商，发送时使用双方都支持的最高版本
+func (this *RpcServer) SetHeaderVersion(headerVersion byte) {
+	this.headerVersion = headerVersion
+}
+
+// SetUseMethodId 设置新连接是否使用方法Id代替方法名发送请求，以减少流量
+// 对方在握手信息中告知能识别的方法Id，握手完成前以及对方不能识别的方法依然使用方法名
+func (this *RpcServer) SetUseMethodId(isUseMethodId bool) {
+	this.isUseMethodId = isUseMethodId
+}
+
+// SetMaxFrameSize 设置新连接能接收的最大帧长度(方法名+内容)，默认为DefaultMaxFrameSize
+// maxFrameSize:最大帧长度，0表示不限制
+// action:收到超长帧时的处理方式
+func (this *RpcServer) SetMaxFrameSize(maxFrameSize uint32, action FrameSizeAction) {
+	this.maxFrameSize = maxFrameSize
+	this.frameSizeAction = action
+}
+
+// SetChecksum 设置新连接是否需要校验码，任意一方需要时双方发送的帧都会带上校验码，校验失败的帧会被丢弃
+func (this *RpcServer) SetChecksum(isChecksum bool) {
+	this.isChecksum = isChecksum
+}
+
+// SetCompression 设置新连接的压缩配置，握手时与对方协商压缩算法
+func (this *RpcServer) SetCompression(config CompressionConfig) {
+	this.compressionConfig = config
+}
+
 func NewRpcServer(byteOrder binary.ByteOrder, getConvertorFunc func() IByteConvertor) *RpcServer {
 	result := &RpcServer{
-		connData:                 make(map[int64]*RpcConnection4Server, 8),
-		ApiMgr:                   newApiMgr(),
-		RpcWatchBase:             newRpcWatchBase(),
-		newConnectionHandlerData: make(map[string]func(connObj RpcConnectioner) error, 8),
-		getConvertorFunc:         getConvertorFunc,
-		connectionTimeoutSecond:  20,
-		byteOrder:                byteOrder,
+		connData:                   make(map[int64]*RpcConnection4Server, 8),
+		ApiMgr:                     newApiMgr(),
+		RpcWatchBase:               newRpcWatchBase(),
+		newConnectionHandlerData:   make(map[string]func(connObj RpcConnectioner) error, 8),
+		handshakeResultHandlerData: make(map[string]func(connObj RpcConnectioner, err error), 8),
+		getConvertorFunc:           getConvertorFunc,
+		connectionTimeoutSecond:    20,
+		byteOrder:                  byteOrder,
+		headerVersion:              HeaderVersion_V2,
+		maxFrameSize:               DefaultMaxFrameSize,
+		acceptErrorHandlerData:     make(map[string]func(listener net.Listener, err error, retryDelay time.Duration), 8),
+		ipConnectionCountData:      make(map[string]int, 8),
+		newConnectionLimiter:       new(rateLimiter),
+		refuseHandlerData:          make(map[string]func(con net.Conn, err error), 8),
+		attrIndexObj:               newAttrIndex(),
+		listenerData:               make(map[net.Listener]struct{}, 1),
+		shutdownChan:               make(chan struct{}),
 	}
 
 	return result
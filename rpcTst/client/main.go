@@ -7,6 +7,7 @@ import (
 
 	"github.com/polariseye/rpc-go"
 	"github.com/polariseye/rpc-go/log"
+	"github.com/polariseye/rpc-go/rpcTst/sampleapi"
 )
 
 var rpcObj = rpc.NewRpcClient(binary.LittleEndian, rpc.GetJsonConvertor)
@@ -47,44 +48,44 @@ func callTst(rpcObj rpc.RpcConnectioner) {
 		fmt.Println("global_Hello : 应答数据:", result)
 	}
 
-	err = rpcObj.Call("Sample_VoidTst", nil, nil)
+	// 使用rpcgen生成的客户端调用服务端的Sample服务
+	sampleClient := sampleapi.NewSampleClient(rpcObj)
+	err = sampleClient.VoidTst()
 	if err != nil {
 		fmt.Println("Sample_VoidTst 错误信息:", err.Error())
 	} else {
 		fmt.Println("Sample_VoidTst : 调用完成:")
 	}
 
-	err = rpcObj.Call("Sample_StringTst2", []interface{}{"qqnihao"}, []interface{}{&result})
+	result, err = sampleClient.StringTst2("qqnihao")
 	if err != nil {
 		fmt.Println("Sample_StringTst2 错误信息:", err.Error())
 	} else {
 		fmt.Println("Sample_StringTst2 : 应答数据:", result)
 	}
 
-	var result2 string
-	err = rpcObj.Call("Sample_StringTst3", []interface{}{"qqnihao1", "qqnihao2"}, []interface{}{&result, &result2})
+	result, result2, err := sampleClient.StringTst3("qqnihao1", "qqnihao2")
 	if err != nil {
 		fmt.Println("Sample_StringTst3 错误信息:", err.Error())
 	} else {
 		fmt.Println("Sample_StringTst3 : 应答数据1:", result, " 应答数据2：", result2)
 	}
 
-	var manObj Man
-	err = rpcObj.Call("Sample_StructTst1", []interface{}{Man{
+	manObj, err := sampleClient.StructTst1(sampleapi.Man{
 		Name: "name1",
 		Sex:  1,
-	}}, []interface{}{&manObj})
+	})
 	if err != nil {
 		fmt.Println("Sample_StructTst1 错误信息:", err.Error())
 	} else {
 		fmt.Println("Sample_StructTst1 : Name:", manObj.Name, " Sex:", manObj.Sex)
 	}
 
-	err = rpcObj.Call("Sample_CallClient", nil, nil)
+	err = sampleClient.CallClient()
 	if err != nil {
 		fmt.Println("Sample_CallClient 错误信息:", err.Error())
 	} else {
-		fmt.Println("Sample_CallClient : 应答数据1:", result, " 应答数据2：", result2)
+		fmt.Println("Sample_CallClient : 调用完成")
 	}
 }
 
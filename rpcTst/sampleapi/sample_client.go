@@ -0,0 +1,59 @@
+// Code generated by rpcgen. DO NOT EDIT.
+
+package sampleapi
+
+import (
+	rpc "github.com/polariseye/rpc-go"
+)
+
+// SampleClient Sample服务的客户端
+type SampleClient struct {
+	connObj rpc.RpcConnectioner
+}
+
+// NewSampleClient 新建Sample服务的客户端
+func NewSampleClient(connObj rpc.RpcConnectioner) *SampleClient {
+	return &SampleClient{
+		connObj: connObj,
+	}
+}
+
+func (this *SampleClient) VoidTst() error {
+	err := this.connObj.Call("Sample_VoidTst", nil, nil)
+	return err
+}
+
+func (this *SampleClient) StringTst1() (string, error) {
+	var result0 string
+	err := this.connObj.Call("Sample_StringTst1", nil, []interface{}{&result0})
+	return result0, err
+}
+
+func (this *SampleClient) StringTst2(name string) (string, error) {
+	var result0 string
+	err := this.connObj.Call("Sample_StringTst2", []interface{}{name}, []interface{}{&result0})
+	return result0, err
+}
+
+func (this *SampleClient) StringTst3(name string, name2 string) (string, string, error) {
+	var result0 string
+	var result1 string
+	err := this.connObj.Call("Sample_StringTst3", []interface{}{name, name2}, []interface{}{&result0, &result1})
+	return result0, result1, err
+}
+
+func (this *SampleClient) StructTst1(man Man) (Man, error) {
+	var result0 Man
+	err := this.connObj.Call("Sample_StructTst1", []interface{}{man}, []interface{}{&result0})
+	return result0, err
+}
+
+func (this *SampleClient) CallClient() error {
+	err := this.connObj.Call("Sample_CallClient", nil, nil)
+	return err
+}
+
+func (this *SampleClient) TimeoutTst() error {
+	err := this.connObj.Call("Sample_TimeoutTst", nil, nil)
+	return err
+}
@@ -0,0 +1,7 @@
+// sampleapi 服务端和客户端共用的Sample服务定义，客户端调用代码由rpcgen生成
+package sampleapi
+
+type Man struct {
+	Name string
+	Sex  int
+}
@@ -5,8 +5,11 @@ import (
 	"time"
 
 	"github.com/polariseye/rpc-go"
+	"github.com/polariseye/rpc-go/rpcTst/sampleapi"
 )
 
+//go:generate go run github.com/polariseye/rpc-go/cmd/rpcgen -type Sample -out ../sampleapi/sample_client.go -pkg sampleapi
+
 type Sample struct {
 }
 
@@ -28,12 +31,7 @@ func (this *Sample) StringTst3(connObj rpc.RpcConnectioner, name string, name2 s
 	return "你好1：" + name, "你好2:" + name2
 }
 
-type Man struct {
-	Name string
-	Sex  int
-}
-
-func (this *Sample) StructTst1(connObj rpc.RpcConnectioner, man Man) (result Man) {
+func (this *Sample) StructTst1(connObj rpc.RpcConnectioner, man sampleapi.Man) (result sampleapi.Man) {
 	man.Name = "Server" + man.Name
 	man.Sex = 10 + man.Sex
 
@@ -0,0 +1,21 @@
+// Code generated by rpcgen. DO NOT EDIT.
+
+package main
+
+import (
+	rpc "github.com/polariseye/rpc-go"
+	"github.com/polariseye/rpc-go/rpcTst/sampleapi"
+)
+
+// SampleServer Sample服务需要实现的接口
+type SampleServer interface {
+	VoidTst(connObj rpc.RpcConnectioner)
+	StringTst1(connObj rpc.RpcConnectioner) string
+	StringTst2(connObj rpc.RpcConnectioner, name string) string
+	StringTst3(connObj rpc.RpcConnectioner, name string, name2 string) (string, string)
+	StructTst1(connObj rpc.RpcConnectioner, man sampleapi.Man) sampleapi.Man
+	CallClient(connObj rpc.RpcConnectioner)
+	TimeoutTst(connObj rpc.RpcConnectioner)
+}
+
+var _ SampleServer = (*Sample)(nil)
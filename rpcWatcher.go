@@ -4,10 +4,14 @@ import "reflect"
 
 type RpcWatcher interface {
 	afterSend(frameObj *DataFrame) (err error)
-	sendSchedule() (err error)
+	sendSchedule(connObj *RpcConnection) (err error)
 	beforeHandleFrame(frameObj *DataFrame) (isHandled bool, err error)
 	afterInvoke(frameObj *DataFrame, returnList []reflect.Value, err error) (resultReturnList []reflect.Value, resultErr error)
 	afterClose()
+	afterPanic(frameObj *DataFrame, panicErr *PanicError)
+	checkHandshake(peerHello *HelloInfo) (err error)
+	afterOversizeFrame(frameObj *DataFrame)
+	afterChecksumError(frameObj *DataFrame)
 }
 
 type RpcWatchBase struct {
@@ -16,6 +20,10 @@ type RpcWatchBase struct {
 	sendScheduleHandlerData      map[string]func(connObj RpcConnectioner)
 	beforeHandleFrameHandlerData map[string]func(connObj RpcConnectioner, frameObj *DataFrame) (isHandled bool, err error)
 	afterInvokeHandlerData       map[string]func(connObj RpcConnectioner, frameObj *DataFrame, returnList []reflect.Value, err error) (resultReturnList []reflect.Value, resultErr error)
+	panicHandlerData             map[string]func(connObj RpcConnectioner, frameObj *DataFrame, panicErr *PanicError)
+	handshakeHandlerData         map[string]func(connObj RpcConnectioner, peerHello *HelloInfo) error
+	oversizeFrameHandlerData     map[string]func(connObj RpcConnectioner, frameObj *DataFrame)
+	checksumErrorHandlerData     map[string]func(connObj RpcConnectioner, frameObj *DataFrame)
 }
 
 func (this *RpcWatchBase) AddCloseHandler(funcName string, funcObj func(connObj RpcConnectioner)) (err error) {
@@ -100,6 +108,74 @@ func (this *RpcWatchBase) invokeAfterInvokeHandler(connObj RpcConnectioner, fram
 	return returnList, err
 }
 
+// AddPanicHandler 添加处理函数异常时的处理
+func (this *RpcWatchBase) AddPanicHandler(funcName string, funcObj func(connObj RpcConnectioner, frameObj *DataFrame, panicErr *PanicError)) (err error) {
+	if _, exist := this.panicHandlerData[funcName]; exist {
+		return HandlerExistedError
+	}
+
+	this.panicHandlerData[funcName] = funcObj
+	return nil
+}
+
+func (this *RpcWatchBase) invokePanicHandler(connObj RpcConnectioner, frameObj *DataFrame, panicErr *PanicError) {
+	for _, item := range this.panicHandlerData {
+		item(connObj, frameObj, panicErr)
+	}
+}
+
+// AddHandshakeHandler 添加握手时的检查，返回error则拒绝对方，错误信息会告知对方
+func (this *RpcWatchBase) AddHandshakeHandler(funcName string, funcObj func(connObj RpcConnectioner, peerHello *HelloInfo) error) (err error) {
+	if _, exist := this.handshakeHandlerData[funcName]; exist {
+		return HandlerExistedError
+	}
+
+	this.handshakeHandlerData[funcName] = funcObj
+	return nil
+}
+
+func (this *RpcWatchBase) invokeHandshakeHandler(connObj RpcConnectioner, peerHello *HelloInfo) error {
+	for _, item := range this.handshakeHandlerData {
+		if err := item(connObj, peerHello); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddOversizeFrameHandler 添加收到超长帧时的处理，此时帧只包含协议头和扩展字段
+func (this *RpcWatchBase) AddOversizeFrameHandler(funcName string, funcObj func(connObj RpcConnectioner, frameObj *DataFrame)) (err error) {
+	if _, exist := this.oversizeFrameHandlerData[funcName]; exist {
+		return HandlerExistedError
+	}
+
+	this.oversizeFrameHandlerData[funcName] = funcObj
+	return nil
+}
+
+func (this *RpcWatchBase) invokeOversizeFrameHandler(connObj RpcConnectioner, frameObj *DataFrame) {
+	for _, item := range this.oversizeFrameHandlerData {
+		item(connObj, frameObj)
+	}
+}
+
+// AddChecksumErrorHandler 添加收到校验失败的帧时的处理，帧会被丢弃
+func (this *RpcWatchBase) AddChecksumErrorHandler(funcName string, funcObj func(connObj RpcConnectioner, frameObj *DataFrame)) (err error) {
+	if _, exist := this.checksumErrorHandlerData[funcName]; exist {
+		return HandlerExistedError
+	}
+
+	this.checksumErrorHandlerData[funcName] = funcObj
+	return nil
+}
+
+func (this *RpcWatchBase) invokeChecksumErrorHandler(connObj RpcConnectioner, frameObj *DataFrame) {
+	for _, item := range this.checksumErrorHandlerData {
+		item(connObj, frameObj)
+	}
+}
+
 func newRpcWatchBase() *RpcWatchBase {
 	return &RpcWatchBase{
 		afterSendHandlerData:         make(map[string]func(connObj RpcConnectioner, frameObj *DataFrame), 4),
@@ -107,5 +183,9 @@ func newRpcWatchBase() *RpcWatchBase {
 		sendScheduleHandlerData:      make(map[string]func(connObj RpcConnectioner), 4),
 		beforeHandleFrameHandlerData: make(map[string]func(connObj RpcConnectioner, frameObj *DataFrame) (isHandled bool, err error), 4),
 		afterInvokeHandlerData:       make(map[string]func(connObj RpcConnectioner, frameObj *DataFrame, returnList []reflect.Value, err error) (resultReturnList []reflect.Value, resultErr error), 4),
+		panicHandlerData:             make(map[string]func(connObj RpcConnectioner, frameObj *DataFrame, panicErr *PanicError), 4),
+		handshakeHandlerData:         make(map[string]func(connObj RpcConnectioner, peerHello *HelloInfo) error, 4),
+		oversizeFrameHandlerData:     make(map[string]func(connObj RpcConnectioner, frameObj *DataFrame), 4),
+		checksumErrorHandlerData:     make(map[string]func(connObj RpcConnectioner, frameObj *DataFrame), 4),
 	}
 }
@@ -0,0 +1,144 @@
+package rpc
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/polariseye/rpc-go/log"
+)
+
+// 关闭服务端时检查连接是否处理完的间隔
+const shutdownPollInterval = 10 * time.Millisecond
+
+// InFlightCount 获取已收到但还没有处理完的请求数量
+func (this *RpcConnection) InFlightCount() int64 {
+	return atomic.LoadInt64(&this.inFlightCount)
+}
+
+// doneRequest 请求处理完成
+func (this *RpcConnection) doneRequest() {
+	atomic.AddInt64(&this.inFlightCount, -1)
+}
+
+// goAway 通知对方连接即将关闭，之后收到的请求直接应答GoingAwayError，只有第一次调用有效
+// ctx:发送队列已满时最多等待到ctx到期
+func (this *RpcConnection) goAway(ctx context.Context) {
+	if atomic.CompareAndSwapInt32(&this.isGoingAway, No, Yes) == false {
+		return
+	}
+
+	frameObj := newRequestFrame(nil, "", nil, this.getRequestId(), false)
+	frameObj.SetTransformType(TransformType_GoAway)
+	this.queueFrame(ctx, frameObj)
+}
+
+// handleGoAway 处理对方发来的即将关闭通知，之后的请求直接返回GoingAwayError
+func (this *RpcConnection) handleGoAway() {
+	log.Info("receive go away ip:%v", this.Addr())
+	atomic.StoreInt32(&this.isPeerGoingAway, Yes)
+}
+
+// closeAfterSend 发送完队列中的帧后关闭连接，只有第一次调用有效
+// ctx:发送队列已满时最多等待到ctx到期
+func (this *RpcConnection) closeAfterSend(ctx context.Context) {
+	if atomic.CompareAndSwapInt32(&this.isCloseAfterSend, No, Yes) == false {
+		return
+	}
+
+	// 发送协程收到nil时关闭连接
+	this.queueFrame(ctx, nil)
+}
+
+// queueFrame 添加帧到发送队列，连接关闭或ctx到期后不再添加
+// ctx到期时由Shutdown强制关闭连接，所以不需要再处理没有添加的帧
+func (this *RpcConnection) queueFrame(ctx context.Context, frameObj *DataFrame) {
+	select {
+	case this.sendChan <- frameObj:
+	case <-this.closeCtx.Done():
+	case <-ctx.Done():
+	}
+}
+
+// Shutdown 优雅关闭服务端
+// 停止监听，并通知所有连接即将关闭，连接上正在处理的请求处理完并应答后关闭连接，之后Start返回
+// ctx:到期后强制关闭所有连接，并返回ctx.Err()
+func (this *RpcServer) Shutdown(ctx context.Context) error {
+	this.stop()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		connList := this.getConnectionList()
+		if len(connList) == 0 {
+			return nil
+		}
+
+		for _, connObj := range connList {
+			// 先通知再检查，确保通知后收到的请求都会被拒绝
+			connObj.goAway(ctx)
+			if connObj.InFlightCount() == 0 {
+				connObj.closeAfterSend(ctx)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			this.closeAllConnection()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close 立即关闭服务端，停止监听并关闭所有连接，正在处理的请求不再应答
+func (this *RpcServer) Close() {
+	this.stop()
+	this.closeAllConnection()
+}
+
+// stop 停止接收新连接，只有第一次调用有效
+func (this *RpcServer) stop() {
+	this.shutdownOnce.Do(func() {
+		// 在锁内关闭，确保之后不会再有连接加入到连接集合中
+		this.connDataLockObj.Lock()
+		close(this.shutdownChan)
+		this.connDataLockObj.Unlock()
+
+		this.listenerLockObj.Lock()
+		defer this.listenerLockObj.Unlock()
+		for listener := range this.listenerData {
+			listener.Close()
+		}
+	})
+}
+
+// isShutdown 是否已经开始关闭
+func (this *RpcServer) isShutdown() bool {
+	select {
+	case <-this.shutdownChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeAllConnection 强制关闭所有连接
+func (this *RpcServer) closeAllConnection() {
+	for _, connObj := range this.getConnectionList() {
+		connObj.close(GoingAwayError)
+	}
+}
+
+// getConnectionList 获取所有连接
+func (this *RpcServer) getConnectionList() []*RpcConnection4Server {
+	this.connDataLockObj.RLock()
+	defer this.connDataLockObj.RUnlock()
+
+	result := make([]*RpcConnection4Server, 0, len(this.connData))
+	for _, connObj := range this.connData {
+		result = append(result, connObj)
+	}
+
+	return result
+}
@@ -0,0 +1,204 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitInFlight 等待服务端收到请求
+func waitInFlight(serverObj *RpcServer) {
+	for i := 0; i < 100; i++ {
+		for _, connObj := range serverObj.getConnectionList() {
+			if connObj.InFlightCount() > 0 {
+				return
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// 可以暂停读取的连接，用于模拟对方不再接收数据
+type pauseReadConn struct {
+	net.Conn
+	isPaused   int32
+	resumeChan chan struct{}
+}
+
+func (this *pauseReadConn) Read(data []byte) (int, error) {
+	if atomic.LoadInt32(&this.isPaused) == Yes {
+		<-this.resumeChan
+	}
+
+	return this.Conn.Read(data)
+}
+
+// fillSendQueue 填满连接的发送队列，对方不再读取时发送协程会阻塞，之后队列一直是满的
+func fillSendQueue(connObj *RpcConnection) {
+	for len(connObj.sendChan) < cap(connObj.sendChan) {
+		for len(connObj.sendChan) < cap(connObj.sendChan) {
+			frameObj := newRequestFrame(nil, "", nil, connObj.getRequestId(), false)
+			frameObj.SetTransformType(TransformType_KeepAlive)
+			select {
+			case connObj.sendChan <- frameObj:
+			default:
+			}
+		}
+
+		// 发送协程可能还会取走正在发送的帧
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	for _, item := range []struct {
+		addr       string
+		sleepTime  time.Duration
+		timeout    time.Duration
+		shutdownOk bool
+	}{
+		{"mem://TestShutdown", 200 * time.Millisecond, 2 * time.Second, true},
+		{"mem://TestShutdownTimeout", 2 * time.Second, 100 * time.Millisecond, false},
+	} {
+		listenerObj, err := listen(item.addr)
+		if err != nil {
+			t.Errorf("listen error:%v", err)
+			return
+		}
+
+		sleepTime := item.sleepTime
+		serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+		serverObj.RegisterFunc("Sample", "Sleep", func(connObj RpcConnectioner) string {
+			time.Sleep(sleepTime)
+			return "done"
+		})
+		stopChan := make(chan struct{})
+		go func() {
+			serverObj.Start2(listenerObj)
+			close(stopChan)
+		}()
+
+		clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+		if err = clientObj.Start(item.addr, false); err != nil {
+			t.Errorf("start error:%v", err)
+			return
+		}
+
+		// 正在处理的请求
+		var result string
+		doneChan, err := clientObj.CallAsync("Sample_Sleep", nil, []interface{}{&result})
+		if err != nil {
+			t.Errorf("call error:%v", err)
+			return
+		}
+		waitInFlight(serverObj)
+
+		ctx, cancel := context.WithTimeout(context.Background(), item.timeout)
+		err = serverObj.Shutdown(ctx)
+		cancel()
+		if item.shutdownOk && err != nil || item.shutdownOk == false && errors.Is(err, context.DeadlineExceeded) == false {
+			t.Errorf("shutdown addr:%v error:%v", item.addr, err)
+		}
+
+		err = <-doneChan
+		if item.shutdownOk && (err != nil || result != "done") || item.shutdownOk == false && err == nil {
+			t.Errorf("in flight request addr:%v error:%v result:%v", item.addr, err, result)
+		}
+
+		select {
+		case <-stopChan:
+		case <-time.After(time.Second):
+			t.Errorf("start not return addr:%v", item.addr)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		if clientObj.IsClosed() == false || serverObj.GetConnectionCount() != 0 {
+			t.Errorf("connection not closed addr:%v", item.addr)
+		}
+	}
+}
+
+func TestShutdownRejectNewRequest(t *testing.T) {
+	serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+	serverObj.RegisterFunc("Sample", "Sleep", func(connObj RpcConnectioner) string {
+		time.Sleep(200 * time.Millisecond)
+		return "done"
+	})
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	closeFunc, err := NewPipePair(serverObj, clientObj)
+	if err != nil {
+		t.Errorf("new pipe pair error:%v", err)
+		return
+	}
+	defer closeFunc()
+
+	doneChan, _ := clientObj.CallAsync("Sample_Sleep", nil, nil)
+	waitInFlight(serverObj)
+	go serverObj.Shutdown(context.Background())
+	time.Sleep(50 * time.Millisecond)
+
+	// 收到通知后不再发送新请求
+	if err = clientObj.Call("Sample_Sleep", nil, nil); errors.Is(err, GoingAwayError) == false {
+		t.Errorf("new request should be going away error:%v", err)
+	}
+	if err = <-doneChan; err != nil {
+		t.Errorf("in flight request error:%v", err)
+	}
+	clientObj.Close()
+}
+
+func TestShutdownSendQueueFull(t *testing.T) {
+	listener := NewPipeListener("")
+	serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+	go serverObj.Start2(listener)
+
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	conObj := &pauseReadConn{resumeChan: make(chan struct{})}
+	clientObj.SetDialer(DialerFunc(func(ctx context.Context, addr string) (net.Conn, error) {
+		con, err := listener.Dial(ctx, addr)
+		conObj.Conn = con
+		return conObj, err
+	}))
+	if err := clientObj.Start(listener.Addr().String(), false); err != nil {
+		t.Errorf("start error:%v", err)
+		return
+	}
+	defer clientObj.Close()
+	defer close(conObj.resumeChan)
+
+	// 服务端握手完成后才会加入连接集合
+	for i := 0; i < 100 && serverObj.GetConnectionCount() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 客户端不再读取，服务端的发送队列被填满
+	atomic.StoreInt32(&conObj.isPaused, Yes)
+	for _, connObj := range serverObj.getConnectionList() {
+		fillSendQueue(connObj.RpcConnection)
+	}
+
+	// 无法发送关闭通知时，到期后依然需要返回并关闭连接
+	errChan := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		errChan <- serverObj.Shutdown(ctx)
+	}()
+	select {
+	case err := <-errChan:
+		if errors.Is(err, context.DeadlineExceeded) == false {
+			t.Errorf("shutdown error:%v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("shutdown not return after deadline")
+		serverObj.Close()
+	}
+	if count := serverObj.GetConnectionCount(); count != 0 {
+		t.Errorf("connection count:%v", count)
+	}
+}
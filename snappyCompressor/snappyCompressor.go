@@ -0,0 +1,35 @@
+package snappyCompressor
+
+import (
+	"github.com/golang/snappy"
+	"github.com/polariseye/rpc-go"
+)
+
+// snappy压缩
+type SnappyCompressor struct {
+}
+
+func (this *SnappyCompressor) Name() string {
+	return "snappy"
+}
+
+func (this *SnappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (this *SnappyCompressor) Decompress(data []byte, maxSize int) ([]byte, error) {
+	// 先根据内容长度判断是否超长
+	dataLen, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && dataLen > maxSize {
+		return nil, rpc.FrameTooLargeError
+	}
+
+	return snappy.Decode(nil, data)
+}
+
+func NewSnappyCompressor() *SnappyCompressor {
+	return &SnappyCompressor{}
+}
@@ -0,0 +1,51 @@
+package snappyCompressor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/polariseye/rpc-go"
+)
+
+func TestSnappyCompressor(t *testing.T) {
+	compressorObj := NewSnappyCompressor()
+	data := bytes.Repeat([]byte("abcdefgh"), 128)
+
+	compressedData, err := compressorObj.Compress(data)
+	if err != nil || len(compressedData) >= len(data) {
+		t.Errorf("compress error:%v len:%v", err, len(compressedData))
+		return
+	}
+
+	result, err := compressorObj.Decompress(compressedData, len(data))
+	if err != nil || bytes.Equal(result, data) == false {
+		t.Errorf("decompress error:%v len:%v", err, len(result))
+		return
+	}
+
+	if _, err = compressorObj.Decompress(compressedData, len(data)-1); errors.Is(err, rpc.FrameTooLargeError) == false {
+		t.Errorf("decompress should be too large error:%v", err)
+	}
+	if _, err = compressorObj.Decompress([]byte{0xff}, len(data)); err == nil {
+		t.Errorf("decompress invalid data should fail")
+	}
+}
+
+func TestSnappyCompressorBomb(t *testing.T) {
+	compressorObj := NewSnappyCompressor()
+
+	// 大量重复数据压缩后很小
+	bombData, _ := compressorObj.Compress(make([]byte, 32*1024*1024))
+	if _, err := compressorObj.Decompress(bombData, 1024); errors.Is(err, rpc.FrameTooLargeError) == false {
+		t.Errorf("bomb should be too large error:%v", err)
+	}
+
+	// 伪造的内容长度，解压前即可发现超长，不会分配内存
+	fakeData := binary.AppendUvarint(nil, 1<<31)
+	fakeData = append(fakeData, 0, 0, 0, 0)
+	if _, err := compressorObj.Decompress(fakeData, 1024); errors.Is(err, rpc.FrameTooLargeError) == false {
+		t.Errorf("fake length should be too large error:%v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+
+	"github.com/polariseye/rpc-go/log"
+)
+
+// 服务端TLS握手的超时时间，超时未完成握手的连接会被关闭
+var tlsHandshakeTimeout = 10 * time.Second
+
+// PeerCertificates 获取对方的证书链，第一个为对方自身的证书，可以在处理函数中用于鉴权
+// 不是TLS连接或TLS握手未完成时返回nil，握手成功后TLS握手一定已经完成
+func (this *RpcConnection) PeerCertificates() []*x509.Certificate {
+	if this == nil {
+		return nil
+	}
+
+	tlsCon, ok := this.con.(*tls.Conn)
+	if ok == false {
+		return nil
+	}
+
+	state := tlsCon.ConnectionState()
+	if state.HandshakeComplete == false {
+		return nil
+	}
+
+	return state.PeerCertificates
+}
+
+// StartTLS 使用TLS监听指定地址
+// addr:监听地址，格式与Start相同
+// config:TLS配置，需要设置Certificates；双向认证时设置ClientAuth为tls.RequireAndVerifyClientCert，并设置ClientCAs
+// TLS握手在单独的协程中完成，10秒内没有完成握手的连接会被关闭；使用Start2传入tls.NewListener创建的监听对象时相同
+func (this *RpcServer) StartTLS(addr string, config *tls.Config) error {
+	listener, err := listen(addr)
+	if err != nil {
+		log.Error("listen error Addr:%v error:%v", addr, err.Error())
+		return err
+	}
+
+	return this.Start2(tls.NewListener(listener, config))
+}
+
+// handshakeTLS 完成TLS握手后再开始处理连接
+// 握手有超时时间，关闭服务端时也会中止握手，避免对方连接后不发送数据导致连接一直被占用
+func (this *RpcServer) handshakeTLS(tlsCon *tls.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-this.shutdownChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := tlsCon.HandshakeContext(ctx); err != nil {
+		log.Warn("tls handshake error ip:%v error:%v", tlsCon.RemoteAddr(), err.Error())
+		tlsCon.Close()
+		this.release(tlsCon)
+		return
+	}
+
+	this.serveConnection(tlsCon)
+}
+
+// SetTLSConfig 设置连接服务端时使用的TLS配置，为nil则不使用TLS，需要在Start前设置，重连后依然有效
+// config:TLS配置，双向认证时需要设置Certificates；没有设置ServerName时使用连接地址中的主机名
+func (this *RpcClient) SetTLSConfig(config *tls.Config) {
+	this.tlsConfig = config
+}
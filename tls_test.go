@@ -0,0 +1,161 @@
+package rpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestCertificate 创建测试证书，parent为nil时创建自签名的CA证书
+func newTestCertificate(t *testing.T, commonName string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	parentCert, parentKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		parentCert, parentKey = parent.Leaf, parent.PrivateKey
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(certBytes)
+
+	return tls.Certificate{Certificate: [][]byte{certBytes}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestTLS(t *testing.T) {
+	caCert := newTestCertificate(t, "ca", nil)
+	caPool := x509.NewCertPool()
+	caPool.AddCert(caCert.Leaf)
+	serverCert := newTestCertificate(t, "server", &caCert)
+	clientCert := newTestCertificate(t, "client", &caCert)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+	serverObj.RegisterFunc("Sample", "WhoAmI", func(connObj RpcConnectioner) string {
+		certList := connObj.PeerCertificates()
+		if len(certList) == 0 {
+			return ""
+		}
+
+		return certList[0].Subject.CommonName
+	})
+	go serverObj.Start2(tls.NewListener(listener, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    caPool,
+	}))
+
+	clientObj := NewRpcClient(binary.LittleEndian, GetJsonConvertor)
+	connectedChan := newConnectedChan(clientObj)
+	clientObj.SetTLSConfig(&tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      caPool,
+	})
+	if err = clientObj.Start(listener.Addr().String(), true); err != nil {
+		t.Errorf("start error:%v", err)
+		return
+	}
+	defer clientObj.Close()
+	waitConnectedChan(connectedChan)
+
+	if certList := clientObj.PeerCertificates(); len(certList) == 0 || certList[0].Subject.CommonName != "server" {
+		t.Errorf("server certificate not match:%v", certList)
+		return
+	}
+
+	var name string
+	if err = clientObj.Call("Sample_WhoAmI", nil, []interface{}{&name}); err != nil || name != "client" {
+		t.Errorf("call error:%v name:%v", err, name)
+		return
+	}
+
+	// 断线后依然使用TLS重连
+	clientObj.Conn().Close()
+	if waitConnectedChan(connectedChan) == false {
+		t.Errorf("reconnect timeout")
+		return
+	}
+
+	err = clientObj.Call("Sample_WhoAmI", nil, []interface{}{&name})
+	if err != nil || name != "client" {
+		t.Errorf("call after reconnect error:%v name:%v", err, name)
+	}
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	oldTimeout := tlsHandshakeTimeout
+	tlsHandshakeTimeout = 100 * time.Millisecond
+	defer func() { tlsHandshakeTimeout = oldTimeout }()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverObj := NewRpcServer(binary.LittleEndian, GetJsonConvertor)
+	defer serverObj.Close()
+	go serverObj.Start2(tls.NewListener(listener, &tls.Config{
+		Certificates: []tls.Certificate{newTestCertificate(t, "server", nil)},
+	}))
+
+	// 连接后不发送任何数据，超时后服务端关闭连接
+	con, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Close()
+
+	con.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err = con.Read(make([]byte, 1)); err == nil {
+		t.Errorf("connection should be closed")
+	} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Errorf("tls handshake not timeout")
+	}
+
+	// 握手失败的连接不再计入连接数
+	var admittedCount int
+	for i := 0; i < 100; i++ {
+		serverObj.admissionLockObj.Lock()
+		admittedCount = serverObj.admittedCount
+		serverObj.admissionLockObj.Unlock()
+		if admittedCount == 0 {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+	if admittedCount != 0 {
+		t.Errorf("admitted count:%v", admittedCount)
+	}
+}
@@ -0,0 +1,145 @@
+package rpc
+
+import (
+	"context"
+	"reflect"
+)
+
+// 没有返回值的方法使用Void作为返回值类型
+type Void struct{}
+
+var voidType = reflect.TypeOf(Void{})
+
+// invokeTyped 根据返回值类型构造应答对象并进行调用
+// 如果返回值是指针类型，会先创建指向的对象再传入，以便ProtobufConvertor等转换器直接反序列化到消息中
+func invokeTyped[Resp any](callFunc func(responseObj []interface{}) error) (resp Resp, err error) {
+	var responseObj []interface{}
+	switch tp := reflect.TypeOf((*Resp)(nil)).Elem(); {
+	case tp == voidType:
+		// 没有返回值
+	case tp.Kind() == reflect.Ptr:
+		resp = reflect.New(tp.Elem()).Interface().(Resp)
+		responseObj = []interface{}{resp}
+	default:
+		responseObj = []interface{}{&resp}
+	}
+
+	err = callFunc(responseObj)
+	return
+}
+
+// Invoke0 调用没有参数的方法
+func Invoke0[Resp any](connObj RpcConnectioner, methodName string) (Resp, error) {
+	return invokeTyped[Resp](func(responseObj []interface{}) error {
+		return connObj.Call(methodName, nil, responseObj)
+	})
+}
+
+// Invoke 调用只有一个参数的方法
+// 如:rpc.Invoke[string, string](connObj, "Sample_StringTst2", "name")
+func Invoke[Req any, Resp any](connObj RpcConnectioner, methodName string, req Req) (Resp, error) {
+	return invokeTyped[Resp](func(responseObj []interface{}) error {
+		return connObj.Call(methodName, []interface{}{req}, responseObj)
+	})
+}
+
+// Invoke2 调用有两个参数的方法
+func Invoke2[Req1 any, Req2 any, Resp any](connObj RpcConnectioner, methodName string, req1 Req1, req2 Req2) (Resp, error) {
+	return invokeTyped[Resp](func(responseObj []interface{}) error {
+		return connObj.Call(methodName, []interface{}{req1, req2}, responseObj)
+	})
+}
+
+// 没有参数的方法
+type Method0[Resp any] struct {
+	methodName string
+}
+
+func (this *Method0[Resp]) MethodName() string {
+	return this.methodName
+}
+
+func (this *Method0[Resp]) Call(connObj RpcConnectioner) (Resp, error) {
+	return Invoke0[Resp](connObj, this.methodName)
+}
+
+func (this *Method0[Resp]) CallContext(ctx context.Context, connObj RpcConnectioner) (Resp, error) {
+	return invokeTyped[Resp](func(responseObj []interface{}) error {
+		return connObj.CallContext(ctx, this.methodName, nil, responseObj)
+	})
+}
+
+// CallAsyncWithNoResponse 调用但不需要应答
+func (this *Method0[Resp]) CallAsyncWithNoResponse(connObj RpcConnectioner) error {
+	return connObj.CallAsyncWithNoResponse(this.methodName, nil, nil)
+}
+
+// NewMethod0 创建没有参数的方法
+func NewMethod0[Resp any](methodName string) *Method0[Resp] {
+	return &Method0[Resp]{
+		methodName: methodName,
+	}
+}
+
+// 只有一个参数的方法
+type Method[Req any, Resp any] struct {
+	methodName string
+}
+
+func (this *Method[Req, Resp]) MethodName() string {
+	return this.methodName
+}
+
+func (this *Method[Req, Resp]) Call(connObj RpcConnectioner, req Req) (Resp, error) {
+	return Invoke[Req, Resp](connObj, this.methodName, req)
+}
+
+func (this *Method[Req, Resp]) CallContext(ctx context.Context, connObj RpcConnectioner, req Req) (Resp, error) {
+	return invokeTyped[Resp](func(responseObj []interface{}) error {
+		return connObj.CallContext(ctx, this.methodName, []interface{}{req}, responseObj)
+	})
+}
+
+// CallAsyncWithNoResponse 调用但不需要应答
+func (this *Method[Req, Resp]) CallAsyncWithNoResponse(connObj RpcConnectioner, req Req) error {
+	return connObj.CallAsyncWithNoResponse(this.methodName, []interface{}{req}, nil)
+}
+
+// NewMethod 创建只有一个参数的方法，一般定义为全局变量，以便多处使用
+// 如:var stringTst2 = rpc.NewMethod[string, string]("Sample_StringTst2")
+func NewMethod[Req any, Resp any](methodName string) *Method[Req, Resp] {
+	return &Method[Req, Resp]{
+		methodName: methodName,
+	}
+}
+
+// 有两个参数的方法
+type Method2[Req1 any, Req2 any, Resp any] struct {
+	methodName string
+}
+
+func (this *Method2[Req1, Req2, Resp]) MethodName() string {
+	return this.methodName
+}
+
+func (this *Method2[Req1, Req2, Resp]) Call(connObj RpcConnectioner, req1 Req1, req2 Req2) (Resp, error) {
+	return Invoke2[Req1, Req2, Resp](connObj, this.methodName, req1, req2)
+}
+
+func (this *Method2[Req1, Req2, Resp]) CallContext(ctx context.Context, connObj RpcConnectioner, req1 Req1, req2 Req2) (Resp, error) {
+	return invokeTyped[Resp](func(responseObj []interface{}) error {
+		return connObj.CallContext(ctx, this.methodName, []interface{}{req1, req2}, responseObj)
+	})
+}
+
+// CallAsyncWithNoResponse 调用但不需要应答
+func (this *Method2[Req1, Req2, Resp]) CallAsyncWithNoResponse(connObj RpcConnectioner, req1 Req1, req2 Req2) error {
+	return connObj.CallAsyncWithNoResponse(this.methodName, []interface{}{req1, req2}, nil)
+}
+
+// NewMethod2 创建有两个参数的方法
+func NewMethod2[Req1 any, Req2 any, Resp any](methodName string) *Method2[Req1, Req2, Resp] {
+	return &Method2[Req1, Req2, Resp]{
+		methodName: methodName,
+	}
+}
@@ -0,0 +1,116 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type typedInfo struct {
+	Name  string
+	Count int
+}
+
+func TestTypedMethod(t *testing.T) {
+	var notifyCount int32
+	apiMgr := newApiMgr()
+	apiMgr.RegisterFunc("Sample", "Hello", func(connObj RpcConnectioner) string { return "hello" })
+	apiMgr.RegisterFunc("Sample", "Echo", func(connObj RpcConnectioner, value string) string { return value })
+	apiMgr.RegisterFunc("Sample", "Add", func(connObj RpcConnectioner, a int, b int) int { return a + b })
+	apiMgr.RegisterFunc("Sample", "Info", func(connObj RpcConnectioner, name string, count int) *typedInfo {
+		return &typedInfo{Name: name, Count: count}
+	})
+	apiMgr.RegisterFunc("Sample", "Fail", func(connObj RpcConnectioner, value string) (string, error) {
+		return "", NewRemoteError(ErrorCode_Custom+1, value)
+	})
+	apiMgr.RegisterFunc("Sample", "Notify", func(connObj RpcConnectioner) {
+		atomic.AddInt32(&notifyCount, 1)
+	})
+
+	serverObj, clientObj := newTestConnectionPair(t, apiMgr)
+	defer serverObj.Close()
+	defer clientObj.Close()
+
+	if value, err := Invoke0[string](clientObj, "Sample_Hello"); err != nil || value != "hello" {
+		t.Errorf("Invoke0 error:%v value:%v", err, value)
+	}
+	if value, err := Invoke[string, string](clientObj, "Sample_Echo", "a"); err != nil || value != "a" {
+		t.Errorf("Invoke error:%v value:%v", err, value)
+	}
+	if value, err := Invoke2[int, int, int](clientObj, "Sample_Add", 1, 2); err != nil || value != 3 {
+		t.Errorf("Invoke2 error:%v value:%v", err, value)
+	}
+
+	// 指针类型的返回值会先创建对象
+	if value, err := Invoke2[string, int, *typedInfo](clientObj, "Sample_Info", "a", 1); err != nil || value == nil || value.Name != "a" || value.Count != 1 {
+		t.Errorf("Invoke2 pointer error:%v value:%+v", err, value)
+	}
+
+	// 不关心返回值时使用Void
+	if _, err := Invoke[string, Void](clientObj, "Sample_Echo", "a"); err != nil {
+		t.Errorf("Invoke void error:%v", err)
+	}
+
+	// 远端错误原样返回
+	var remoteErr *RemoteError
+	if _, err := Invoke[string, string](clientObj, "Sample_Fail", "biz error"); errors.As(err, &remoteErr) == false || remoteErr.Code != ErrorCode_Custom+1 {
+		t.Errorf("expect remote error but got:%v", err)
+	}
+
+	// 参数类型与处理函数不一致
+	if _, err := Invoke[int, string](clientObj, "Sample_Echo", 1); errors.Is(err, ParamDecodeError) == false {
+		t.Errorf("expect ParamDecodeError but got:%v", err)
+	}
+
+	// 返回值类型与处理函数不一致
+	if _, err := Invoke[string, int](clientObj, "Sample_Echo", "a"); err == nil {
+		t.Errorf("expect response type mismatch error")
+	}
+
+	if _, err := Invoke0[string](clientObj, "Sample_NotExist"); errors.Is(err, MethodNotFoundError) == false {
+		t.Errorf("expect MethodNotFoundError but got:%v", err)
+	}
+
+	// 通过方法对象调用
+	ctx := context.Background()
+	hello := NewMethod0[string]("Sample_Hello")
+	if value, err := hello.Call(clientObj); err != nil || value != "hello" {
+		t.Errorf("Method0 error:%v value:%v", err, value)
+	}
+	if value, err := hello.CallContext(ctx, clientObj); err != nil || value != "hello" {
+		t.Errorf("Method0 context error:%v value:%v", err, value)
+	}
+
+	echo := NewMethod[string, string]("Sample_Echo")
+	if value, err := echo.Call(clientObj, "b"); err != nil || value != "b" {
+		t.Errorf("Method error:%v value:%v", err, value)
+	}
+	if value, err := echo.CallContext(ctx, clientObj, "c"); err != nil || value != "c" {
+		t.Errorf("Method context error:%v value:%v", err, value)
+	}
+
+	add := NewMethod2[int, int, int]("Sample_Add")
+	if value, err := add.Call(clientObj, 2, 3); err != nil || value != 5 {
+		t.Errorf("Method2 error:%v value:%v", err, value)
+	}
+	if value, err := add.CallContext(ctx, clientObj, 3, 4); err != nil || value != 7 {
+		t.Errorf("Method2 context error:%v value:%v", err, value)
+	}
+
+	// 不需要应答的调用
+	notify := NewMethod0[Void]("Sample_Notify")
+	if err := notify.CallAsyncWithNoResponse(clientObj); err != nil {
+		t.Errorf("Method0 no response error:%v", err)
+	}
+	if _, err := notify.Call(clientObj); err != nil {
+		t.Errorf("Method0 void error:%v", err)
+	}
+	for i := 0; i < 100 && atomic.LoadInt32(&notifyCount) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count := atomic.LoadInt32(&notifyCount); count != 2 {
+		t.Errorf("notify count:%v", count)
+	}
+}
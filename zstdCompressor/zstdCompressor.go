@@ -0,0 +1,87 @@
+package zstdCompressor
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/polariseye/rpc-go"
+)
+
+// zstd压缩
+type ZstdCompressor struct {
+	encoder     *zstd.Encoder
+	decoderPool sync.Pool //// 流式解压对象，解压时按长度限制读取，不会一次解出整个帧
+}
+
+func (this *ZstdCompressor) Name() string {
+	return "zstd"
+}
+
+func (this *ZstdCompressor) Compress(data []byte) ([]byte, error) {
+	return this.encoder.EncodeAll(data, nil), nil
+}
+
+// Decompress 解压
+// maxSize:解压后的最大长度，超过时返回FrameTooLargeError，0表示不限制
+func (this *ZstdCompressor) Decompress(data []byte, maxSize int) ([]byte, error) {
+	decoder, err := this.getDecoder()
+	if err != nil {
+		return nil, err
+	}
+	defer this.putDecoder(decoder)
+
+	// 数据可能包含多个帧，帧头中的内容长度也可以伪造，所以按实际解压出的长度判断
+	if err = decoder.Reset(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader = decoder
+	if maxSize > 0 {
+		// 多读一个字节，用于判断是否超长
+		reader = io.LimitReader(decoder, int64(maxSize)+1)
+	}
+
+	result, err := io.ReadAll(reader)
+	if err != nil {
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+			return nil, rpc.FrameTooLargeError
+		}
+
+		return nil, err
+	}
+	if maxSize > 0 && len(result) > maxSize {
+		return nil, rpc.FrameTooLargeError
+	}
+
+	return result, nil
+}
+
+func (this *ZstdCompressor) getDecoder() (*zstd.Decoder, error) {
+	if decoder, ok := this.decoderPool.Get().(*zstd.Decoder); ok {
+		return decoder, nil
+	}
+
+	// 单协程解压，不会创建后台协程，放回池中前不需要Close
+	return zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+}
+
+func (this *ZstdCompressor) putDecoder(decoder *zstd.Decoder) {
+	// 释放对数据的引用
+	decoder.Reset(nil)
+	this.decoderPool.Put(decoder)
+}
+
+// NewZstdCompressor 新建zstd压缩，可以在多个连接中共用
+func NewZstdCompressor() (*ZstdCompressor, error) {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ZstdCompressor{
+		encoder: encoder,
+	}, nil
+}
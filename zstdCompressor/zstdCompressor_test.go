@@ -0,0 +1,65 @@
+package zstdCompressor
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/polariseye/rpc-go"
+)
+
+func TestZstdCompressor(t *testing.T) {
+	compressorObj, err := NewZstdCompressor()
+	if err != nil {
+		t.Errorf("new error:%v", err)
+		return
+	}
+
+	data := bytes.Repeat([]byte("abcdefgh"), 128)
+	compressedData, err := compressorObj.Compress(data)
+	if err != nil || len(compressedData) >= len(data) {
+		t.Errorf("compress error:%v len:%v", err, len(compressedData))
+		return
+	}
+
+	// 解压对象重复使用
+	for i := 0; i < 2; i++ {
+		result, err := compressorObj.Decompress(compressedData, len(data))
+		if err != nil || bytes.Equal(result, data) == false {
+			t.Errorf("decompress error:%v len:%v", err, len(result))
+			return
+		}
+	}
+
+	if _, err = compressorObj.Decompress(compressedData, len(data)-1); errors.Is(err, rpc.FrameTooLargeError) == false {
+		t.Errorf("decompress should be too large error:%v", err)
+	}
+	if _, err = compressorObj.Decompress([]byte("invalid data"), len(data)); err == nil {
+		t.Errorf("decompress invalid data should fail")
+	}
+}
+
+func TestZstdCompressorBomb(t *testing.T) {
+	compressorObj, err := NewZstdCompressor()
+	if err != nil {
+		t.Errorf("new error:%v", err)
+		return
+	}
+
+	// 大量重复数据压缩后很小
+	bombData, _ := compressorObj.Compress(make([]byte, 32*1024*1024))
+	if _, err = compressorObj.Decompress(bombData, 1024); errors.Is(err, rpc.FrameTooLargeError) == false {
+		t.Errorf("bomb should be too large error:%v", err)
+	}
+
+	// maxSize为0时不限制长度
+	if result, err := compressorObj.Decompress(bombData, 0); err != nil || len(result) != 32*1024*1024 {
+		t.Errorf("decompress error:%v len:%v", err, len(result))
+	}
+
+	// 第一个帧很小，只检查第一个帧头时无法发现后续的大帧
+	smallData, _ := compressorObj.Compress([]byte("small"))
+	if _, err = compressorObj.Decompress(append(smallData, bombData...), 1024); errors.Is(err, rpc.FrameTooLargeError) == false {
+		t.Errorf("multi frame bomb should be too large error:%v", err)
+	}
+}